@@ -0,0 +1,101 @@
+// Package authenticators 提供可替换的用户名密码认证后端，
+// 登录接口通过AUTH_BACKEND配置选择使用本地密码、LDAP或按顺序组合使用
+package authenticators
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/weicopy/backend/config"
+	"github.com/weicopy/backend/models"
+)
+
+// ErrInvalidCredentials 用户不存在或密码错误
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// Authenticator 用户名密码认证后端，认证成功时返回对应的本地用户
+type Authenticator interface {
+	Name() string
+	Authenticate(username, password string) (*models.User, error)
+}
+
+var (
+	defaultAuthenticator Authenticator
+	defaultOnce          sync.Once
+)
+
+// Default 根据AUTH_BACKEND配置返回登录使用的认证后端
+func Default() Authenticator {
+	defaultOnce.Do(func() {
+		auth, err := New(config.GetAuthBackends())
+		if err != nil {
+			log.Fatalf("Failed to configure authentication backend: %v", err)
+		}
+		defaultAuthenticator = auth
+	})
+	return defaultAuthenticator
+}
+
+// New 按名称创建认证后端，多个名称时按顺序依次尝试
+func New(names []string) (Authenticator, error) {
+	var chain Chain
+	for _, name := range names {
+		switch strings.ToLower(name) {
+		case "local":
+			chain = append(chain, Local{})
+		case "ldap":
+			ldap, err := NewLDAPFromConfig()
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, ldap)
+		default:
+			return nil, errors.New("unknown authentication backend: " + name)
+		}
+	}
+
+	if len(chain) == 0 {
+		return Local{}, nil
+	}
+	if len(chain) == 1 {
+		return chain[0], nil
+	}
+	return chain, nil
+}
+
+// Chain 依次尝试多个认证后端，返回第一个认证成功的结果
+// 只要有一个后端拒绝了凭据就视为凭据错误，只有所有后端都不可用时才返回后端的错误
+type Chain []Authenticator
+
+func (c Chain) Name() string {
+	names := make([]string, 0, len(c))
+	for _, auth := range c {
+		names = append(names, auth.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+func (c Chain) Authenticate(username, password string) (*models.User, error) {
+	var backendErr error
+	rejected := false
+	for _, auth := range c {
+		user, err := auth.Authenticate(username, password)
+		if err == nil {
+			return user, nil
+		}
+		if errors.Is(err, ErrInvalidCredentials) {
+			rejected = true
+			continue
+		}
+		// 后端不可用时继续尝试下一个，但保留错误便于排查
+		log.Printf("auth: %s backend failed: %v", auth.Name(), err)
+		backendErr = err
+	}
+
+	if rejected || backendErr == nil {
+		return nil, ErrInvalidCredentials
+	}
+	return nil, backendErr
+}
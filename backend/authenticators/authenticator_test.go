@@ -0,0 +1,144 @@
+package authenticators
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/weicopy/backend/models"
+)
+
+// 模拟的认证后端，用于代替LDAP等外部服务
+type stubAuthenticator struct {
+	name string
+	user *models.User
+	err  error
+}
+
+func (s stubAuthenticator) Name() string {
+	return s.name
+}
+
+func (s stubAuthenticator) Authenticate(username, password string) (*models.User, error) {
+	return s.user, s.err
+}
+
+var errUnavailable = errors.New("ldap dial: connection refused")
+
+func TestChainAuthenticate(t *testing.T) {
+	alice := &models.User{Username: "alice"}
+
+	var (
+		accept      = stubAuthenticator{name: "accept", user: alice}
+		reject      = stubAuthenticator{name: "reject", err: ErrInvalidCredentials}
+		unavailable = stubAuthenticator{name: "unavailable", err: errUnavailable}
+	)
+
+	tests := []struct {
+		name    string
+		chain   Chain
+		wantErr error
+	}{
+		{"first backend accepts", Chain{accept, reject}, nil},
+		{"fallback after rejection", Chain{reject, accept}, nil},
+		{"fallback after backend error", Chain{unavailable, accept}, nil},
+		{"all backends reject", Chain{reject, reject}, ErrInvalidCredentials},
+		{"unavailable then rejected", Chain{unavailable, reject}, ErrInvalidCredentials},
+		{"rejected then unavailable", Chain{reject, unavailable}, ErrInvalidCredentials},
+		{"all backends unavailable", Chain{unavailable, unavailable}, errUnavailable},
+		{"empty chain", Chain{}, ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := tt.chain.Authenticate("alice", "secret1")
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Authenticate() error = %v", err)
+				}
+				if user != alice {
+					t.Errorf("Authenticate() user = %v, want alice", user)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// 返回一个没有服务监听的LDAP地址
+func unreachableLDAPURL(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	return "ldap://" + addr
+}
+
+func TestChainWithUnreachableLDAP(t *testing.T) {
+	setupTestDB(t)
+
+	if _, err := models.CreateUser("alice", "secret1"); err != nil {
+		t.Fatal(err)
+	}
+
+	ldap, err := NewLDAP(LDAPConfig{URL: unreachableLDAPURL(t), BaseDN: "dc=example,dc=com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 目录服务不可用时单独使用LDAP返回后端错误
+	if _, err := ldap.Authenticate("alice", "secret1"); err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("ldap.Authenticate() error = %v, want a backend error", err)
+	}
+
+	chain := Chain{ldap, Local{}}
+
+	user, err := chain.Authenticate("alice", "secret1")
+	if err != nil {
+		t.Fatalf("local fallback failed: %v", err)
+	}
+	if user.Username != "alice" {
+		t.Errorf("user = %s, want alice", user.Username)
+	}
+
+	// 本地密码错误时应返回凭据错误，而不是LDAP的连接错误
+	if _, err := chain.Authenticate("alice", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong password error = %v, want ErrInvalidCredentials", err)
+	}
+	if _, err := chain.Authenticate("bob", "secret1"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("unknown user error = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestLDAPRejectsEmptyPassword(t *testing.T) {
+	ldap, err := NewLDAP(LDAPConfig{URL: unreachableLDAPURL(t), BaseDN: "dc=example,dc=com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 空密码在连接目录服务前就被拒绝，避免匿名绑定
+	if _, err := ldap.Authenticate("alice", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate() error = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	auth, err := New([]string{"local"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := auth.(Local); !ok {
+		t.Errorf("New(local) = %T, want Local", auth)
+	}
+
+	if _, err := New([]string{"kerberos"}); err == nil {
+		t.Error("New() accepted an unknown backend")
+	}
+}
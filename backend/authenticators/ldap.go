@@ -0,0 +1,175 @@
+package authenticators
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/weicopy/backend/config"
+	"github.com/weicopy/backend/models"
+)
+
+// LDAP连接超时时间
+const ldapTimeout = 10 * time.Second
+
+// LDAPConfig LDAP目录服务配置
+type LDAPConfig struct {
+	URL          string
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// 查找用户的过滤器，%s替换为转义后的用户名
+	UserFilter string
+	// 作为本地用户名的属性，为空时使用登录时输入的用户名
+	UsernameAttribute string
+	StartTLS          bool
+	AutoProvision     bool
+}
+
+// LDAP 先用服务账户查找用户条目，再以该条目的DN和用户密码绑定完成认证
+// 目录用户通过外部身份关联到本地用户，签发方为LDAP地址，subject为条目DN
+type LDAP struct {
+	config LDAPConfig
+}
+
+// NewLDAP 创建LDAP认证后端
+func NewLDAP(cfg LDAPConfig) (*LDAP, error) {
+	if cfg.URL == "" || cfg.BaseDN == "" {
+		return nil, errors.New("LDAP_URL and LDAP_BASE_DN are required for the ldap backend")
+	}
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(uid=%s)"
+	}
+	if !strings.Contains(cfg.UserFilter, "%s") {
+		return nil, errors.New("LDAP_USER_FILTER must contain %s")
+	}
+	return &LDAP{config: cfg}, nil
+}
+
+// NewLDAPFromConfig 根据环境变量创建LDAP认证后端
+func NewLDAPFromConfig() (*LDAP, error) {
+	return NewLDAP(LDAPConfig{
+		URL:               config.GetLDAPURL(),
+		BindDN:            config.GetLDAPBindDN(),
+		BindPassword:      config.GetLDAPBindPassword(),
+		BaseDN:            config.GetLDAPBaseDN(),
+		UserFilter:        config.GetLDAPUserFilter(),
+		UsernameAttribute: config.GetLDAPUsernameAttribute(),
+		StartTLS:          config.IsLDAPStartTLSEnabled(),
+		AutoProvision:     config.IsLDAPAutoProvisionEnabled(),
+	})
+}
+
+func (l *LDAP) Name() string {
+	return "ldap"
+}
+
+func (l *LDAP) Authenticate(username, password string) (*models.User, error) {
+	// 空密码会被服务器视为匿名绑定而成功，必须拒绝
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	dn, name, err := l.verify(username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	// DN不区分大小写，统一转为小写作为subject
+	issuer, subject := l.issuer(), strings.ToLower(dn)
+	user, err := models.FindUserByIdentity(issuer, subject)
+	if err == nil {
+		return user, nil
+	}
+
+	if !l.config.AutoProvision {
+		return nil, ErrInvalidCredentials
+	}
+
+	return models.ProvisionIdentityUser(issuer, subject, name)
+}
+
+// 查找用户条目并以用户密码绑定，返回条目DN和本地用户名
+func (l *LDAP) verify(username, password string) (string, string, error) {
+	conn, err := ldap.DialURL(l.config.URL, ldap.DialWithDialer(&net.Dialer{Timeout: ldapTimeout}))
+	if err != nil {
+		return "", "", fmt.Errorf("ldap dial: %w", err)
+	}
+	defer conn.Close()
+	conn.SetTimeout(ldapTimeout)
+
+	if l.config.StartTLS {
+		host := l.config.URL
+		if u, err := url.Parse(l.config.URL); err == nil {
+			host = u.Hostname()
+		}
+		if err := conn.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return "", "", fmt.Errorf("ldap starttls: %w", err)
+		}
+	}
+
+	// 使用服务账户查找，未配置时匿名查找
+	if l.config.BindDN != "" {
+		err = conn.Bind(l.config.BindDN, l.config.BindPassword)
+	} else {
+		err = conn.UnauthenticatedBind("")
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("ldap service bind: %w", err)
+	}
+
+	attributes := []string{"dn"}
+	if l.config.UsernameAttribute != "" {
+		attributes = append(attributes, l.config.UsernameAttribute)
+	}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		l.config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(ldapTimeout.Seconds()), false,
+		strings.ReplaceAll(l.config.UserFilter, "%s", ldap.EscapeFilter(username)),
+		attributes,
+		nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return "", "", fmt.Errorf("ldap search: %w", err)
+	}
+	// 找不到或匹配到多个条目时都视为认证失败
+	if result == nil || len(result.Entries) != 1 {
+		return "", "", ErrInvalidCredentials
+	}
+
+	entry := result.Entries[0]
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return "", "", ErrInvalidCredentials
+		}
+		return "", "", fmt.Errorf("ldap user bind: %w", err)
+	}
+
+	name := username
+	if l.config.UsernameAttribute != "" {
+		if value := entry.GetAttributeValue(l.config.UsernameAttribute); value != "" {
+			name = value
+		}
+	}
+
+	return entry.DN, name, nil
+}
+
+// IsDirectoryIssuer 外部身份是否来自LDAP目录，这类用户可以使用目录密码认证
+func IsDirectoryIssuer(issuer string) bool {
+	return strings.HasPrefix(issuer, "ldap://") || strings.HasPrefix(issuer, "ldaps://") || strings.HasPrefix(issuer, "ldapi://")
+}
+
+// 外部身份的签发方标识，去除路径等无关部分
+func (l *LDAP) issuer() string {
+	if u, err := url.Parse(l.config.URL); err == nil && u.Host != "" {
+		return strings.ToLower(u.Scheme + "://" + u.Host)
+	}
+	return l.config.URL
+}
@@ -0,0 +1,291 @@
+package authenticators
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/weicopy/backend/models"
+)
+
+// 测试目录中的服务账户
+const (
+	testBindDN       = "cn=admin,dc=example,dc=com"
+	testBindPassword = "adminpw"
+)
+
+// 目录中的一个用户条目
+type fakeLDAPEntry struct {
+	dn       string
+	uid      string
+	password string
+}
+
+// 在本地监听的简易LDAP服务，只处理简单绑定和按uid的等值查找
+type fakeLDAPServer struct {
+	listener net.Listener
+	entries  []fakeLDAPEntry
+
+	mu    sync.Mutex
+	binds []string
+}
+
+func newFakeLDAPServer(t *testing.T, entries ...fakeLDAPEntry) *fakeLDAPServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeLDAPServer{listener: listener, entries: entries}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeLDAPServer) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+// 返回收到的所有绑定请求的DN
+func (s *fakeLDAPServer) boundDNs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.binds...)
+}
+
+func (s *fakeLDAPServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID := packet.Children[0].Value.(int64)
+		request := packet.Children[1]
+
+		switch request.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := request.Children[1].Value.(string)
+			password := request.Children[2].Data.String()
+			s.mu.Lock()
+			s.binds = append(s.binds, dn)
+			s.mu.Unlock()
+
+			code := int64(ldap.LDAPResultInvalidCredentials)
+			if s.checkPassword(dn, password) {
+				code = ldap.LDAPResultSuccess
+			}
+			s.write(conn, messageID, ldapResult(ldap.ApplicationBindResponse, code))
+		case ldap.ApplicationSearchRequest:
+			baseDN := request.Children[0].Value.(string)
+			filter, err := ldap.DecompileFilter(request.Children[6])
+			if err != nil {
+				s.write(conn, messageID, ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError))
+				continue
+			}
+			for _, entry := range s.entries {
+				if strings.HasSuffix(entry.dn, baseDN) && filter == "(uid="+ldap.EscapeFilter(entry.uid)+")" {
+					s.write(conn, messageID, searchResultEntry(entry))
+				}
+			}
+			s.write(conn, messageID, ldapResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+		case ldap.ApplicationUnbindRequest:
+			return
+		default:
+			return
+		}
+	}
+}
+
+func (s *fakeLDAPServer) checkPassword(dn, password string) bool {
+	if dn == testBindDN {
+		return password == testBindPassword
+	}
+	for _, entry := range s.entries {
+		if strings.EqualFold(entry.dn, dn) {
+			return password != "" && password == entry.password
+		}
+	}
+	return false
+}
+
+func (s *fakeLDAPServer) write(conn net.Conn, messageID int64, response *ber.Packet) {
+	envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "MessageID"))
+	envelope.AppendChild(response)
+	conn.Write(envelope.Bytes())
+}
+
+func ldapResult(tag ber.Tag, code int64) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "resultCode"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	return result
+}
+
+func searchResultEntry(entry fakeLDAPEntry) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "objectName"))
+
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+	attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "uid", "type"))
+	values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "values")
+	values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.uid, "value"))
+	attribute.AppendChild(values)
+	attributes.AppendChild(attribute)
+	result.AppendChild(attributes)
+	return result
+}
+
+// 测试目录：alice为普通用户，bob在两个组织单位中各有一个条目
+func newTestDirectory(t *testing.T) *fakeLDAPServer {
+	return newFakeLDAPServer(t,
+		fakeLDAPEntry{dn: "uid=alice,ou=People,dc=example,dc=com", uid: "alice", password: "directorypw"},
+		fakeLDAPEntry{dn: "uid=bob,ou=People,dc=example,dc=com", uid: "bob", password: "bobpw1"},
+		fakeLDAPEntry{dn: "uid=bob,ou=Contractors,dc=example,dc=com", uid: "bob", password: "bobpw2"},
+	)
+}
+
+func newTestLDAP(t *testing.T, server *fakeLDAPServer, autoProvision bool) *LDAP {
+	t.Helper()
+
+	l, err := NewLDAP(LDAPConfig{
+		URL:               server.URL(),
+		BindDN:            testBindDN,
+		BindPassword:      testBindPassword,
+		BaseDN:            "dc=example,dc=com",
+		UsernameAttribute: "uid",
+		AutoProvision:     autoProvision,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestLDAPAuthenticateProvisionsUser(t *testing.T) {
+	setupTestDB(t)
+	server := newTestDirectory(t)
+	l := newTestLDAP(t, server, true)
+
+	user, err := l.Authenticate("alice", "directorypw")
+	if err != nil {
+		t.Fatalf("Authenticate() error = %v", err)
+	}
+	if user.Username != "alice" {
+		t.Errorf("Username = %s, want alice", user.Username)
+	}
+	// 自动创建的目录用户没有本地密码
+	if user.HasLocalPassword() {
+		t.Error("provisioned user has a local password")
+	}
+
+	identities, err := models.GetUserIdentities(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 1 {
+		t.Fatalf("identities = %d, want 1", len(identities))
+	}
+	if identities[0].Issuer != server.URL() || identities[0].Subject != "uid=alice,ou=people,dc=example,dc=com" {
+		t.Errorf("identity = %s %s", identities[0].Issuer, identities[0].Subject)
+	}
+
+	want := []string{testBindDN, "uid=alice,ou=People,dc=example,dc=com"}
+	if got := server.boundDNs(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("binds = %v, want %v", got, want)
+	}
+
+	// 再次登录使用已关联的用户
+	again, err := l.Authenticate("alice", "directorypw")
+	if err != nil {
+		t.Fatalf("second Authenticate() error = %v", err)
+	}
+	if again.ID != user.ID {
+		t.Errorf("second login user ID = %d, want %d", again.ID, user.ID)
+	}
+}
+
+func TestLDAPAuthenticateRejects(t *testing.T) {
+	setupTestDB(t)
+	server := newTestDirectory(t)
+	l := newTestLDAP(t, server, true)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+	}{
+		{"wrong password", "alice", "wrongpw"},
+		{"unknown user", "carol", "directorypw"},
+		{"multiple matches", "bob", "bobpw1"},
+		{"filter injection", "*", "directorypw"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := l.Authenticate(tt.username, tt.password); !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("Authenticate() error = %v, want ErrInvalidCredentials", err)
+			}
+		})
+	}
+
+	// 匹配到多个条目时不应尝试以任何一个条目绑定
+	for _, dn := range server.boundDNs() {
+		if strings.Contains(dn, "uid=bob") {
+			t.Errorf("bound as %s although the search was ambiguous", dn)
+		}
+	}
+
+	var count int64
+	models.DB.Model(&models.User{}).Count(&count)
+	if count != 0 {
+		t.Errorf("rejected logins created %d users", count)
+	}
+}
+
+func TestLDAPAuthenticateWithoutAutoProvision(t *testing.T) {
+	setupTestDB(t)
+	l := newTestLDAP(t, newTestDirectory(t), false)
+
+	// 目录密码正确但尚未关联本地用户
+	if _, err := l.Authenticate("alice", "directorypw"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate() error = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestLDAPServiceBindFailure(t *testing.T) {
+	server := newTestDirectory(t)
+	l, err := NewLDAP(LDAPConfig{
+		URL:          server.URL(),
+		BindDN:       testBindDN,
+		BindPassword: "wrong",
+		BaseDN:       "dc=example,dc=com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 服务账户配置错误属于后端错误，不能当作用户密码错误
+	_, err = l.Authenticate("alice", "directorypw")
+	if err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Authenticate() error = %v, want a backend error", err)
+	}
+}
@@ -0,0 +1,31 @@
+package authenticators
+
+import (
+	"github.com/weicopy/backend/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 用于不存在的用户名的占位哈希，代价与真实密码哈希相同
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("weicopy-dummy-password"), bcrypt.DefaultCost)
+
+// Local 使用本地数据库中的bcrypt密码认证
+type Local struct{}
+
+func (Local) Name() string {
+	return "local"
+}
+
+func (Local) Authenticate(username, password string) (*models.User, error) {
+	user, err := models.FindUserByUsername(username)
+	if err != nil || !user.HasLocalPassword() {
+		// 用户不存在或没有本地密码时同样执行一次bcrypt比较，避免通过响应时间判断用户名是否存在
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := user.CheckPassword(password); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
@@ -0,0 +1,31 @@
+package authenticators
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/weicopy/backend/models"
+	"gorm.io/gorm/logger"
+)
+
+// 使用临时目录中的数据库和上传目录，供本包的测试共用
+func setupTestDB(t *testing.T) {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Setenv("DB_PATH", filepath.Join(dir, "weicopy.db"))
+	t.Setenv("UPLOAD_PATH", filepath.Join(dir, "uploads"))
+	t.Setenv("STORAGE_BACKEND", "local")
+
+	if err := models.OpenDatabase(logger.Silent); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := models.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/weicopy/backend/models"
+	"golang.org/x/term"
+	"gorm.io/gorm/logger"
+)
+
+// 处理user子命令
+func runUserCommand(args []string) {
+	if len(args) == 0 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "add":
+		runUserAdd(args[1:])
+	case "passwd":
+		runUserPasswd(args[1:])
+	case "del":
+		runUserDel(args[1:])
+	case "list":
+		runUserList(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown user command %q\n\n", args[0])
+		printUsage()
+		os.Exit(2)
+	}
+}
+
+// 处理token子命令
+func runTokenCommand(args []string) {
+	if len(args) == 0 || args[0] != "issue" {
+		printUsage()
+		os.Exit(2)
+	}
+	runTokenIssue(args[1:])
+}
+
+// 处理db子命令
+func runDBCommand(args []string) {
+	if len(args) == 0 || args[0] != "migrate" {
+		printUsage()
+		os.Exit(2)
+	}
+
+	openDatabase()
+	fmt.Println("Database migrated successfully")
+}
+
+// weicopy user add [-admin] <username>
+func runUserAdd(args []string) {
+	flags := flag.NewFlagSet("user add", flag.ExitOnError)
+	admin := flags.Bool("admin", false, "grant the administrator role")
+	username := parseUsernameArg(flags, args)
+
+	if len(username) < 3 || len(username) > 50 {
+		fatalf("Username must be between 3 and 50 characters")
+	}
+
+	openDatabase()
+	if _, err := models.FindUserByUsername(username); err == nil {
+		fatalf("User %q already exists", username)
+	}
+
+	password := readPassword()
+
+	role := models.RoleUser
+	if *admin {
+		role = models.RoleAdmin
+	}
+
+	user, err := models.CreateUserWithRole(username, password, role)
+	if err != nil {
+		fatalf("Failed to create user: %v", err)
+	}
+
+	fmt.Printf("Created %s %q (id %d)\n", user.Role, user.Username, user.ID)
+}
+
+// weicopy user passwd <username>
+func runUserPasswd(args []string) {
+	flags := flag.NewFlagSet("user passwd", flag.ExitOnError)
+	username := parseUsernameArg(flags, args)
+
+	openDatabase()
+	user := findUser(username)
+	password := readPassword()
+
+	if err := models.ResetUserPassword(user.ID, password); err != nil {
+		fatalf("Failed to reset password: %v", err)
+	}
+
+	fmt.Printf("Password of %q reset, all sessions revoked\n", user.Username)
+}
+
+// weicopy user del <username>
+func runUserDel(args []string) {
+	flags := flag.NewFlagSet("user del", flag.ExitOnError)
+	username := parseUsernameArg(flags, args)
+
+	openDatabase()
+	user := findUser(username)
+
+	if err := models.DeleteUser(user.ID); err != nil {
+		fatalf("Failed to delete user: %v", err)
+	}
+
+	fmt.Printf("Deleted user %q and all of their data\n", user.Username)
+}
+
+// weicopy user list
+func runUserList(args []string) {
+	flags := flag.NewFlagSet("user list", flag.ExitOnError)
+	flags.Parse(args)
+
+	openDatabase()
+	users, err := models.GetUsers()
+	if err != nil {
+		fatalf("Failed to list users: %v", err)
+	}
+
+	usage, err := models.GetStorageUsage()
+	if err != nil {
+		fatalf("Failed to calculate storage usage: %v", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSERNAME\tROLE\tSTATUS\tITEMS\tBYTES\tCREATED")
+	for _, user := range users {
+		status := "active"
+		if user.IsDisabled() {
+			status = "disabled"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%d\t%s\n", user.ID, user.Username, user.Role, status,
+			usage[user.ID].ItemCount, usage[user.ID].Bytes, user.CreatedAt.Format("2006-01-02 15:04"))
+	}
+	w.Flush()
+}
+
+// weicopy token issue [-name name] [-scopes a,b] [-days n] <username>
+func runTokenIssue(args []string) {
+	flags := flag.NewFlagSet("token issue", flag.ExitOnError)
+	name := flags.String("name", "cli", "token name, also used as the device name")
+	scopeList := flags.String("scopes", strings.Join(models.DefaultTokenScopes, ","), "comma separated scopes")
+	days := flags.Int("days", 0, "days until the token expires, 0 means never")
+	username := parseUsernameArg(flags, args)
+
+	if *days < 0 {
+		fatalf("-days cannot be negative")
+	}
+
+	scopes, err := models.ParseScopes(strings.Split(*scopeList, ","))
+	if err != nil || len(scopes) == 0 {
+		fatalf("Invalid scopes %q, available: %s", *scopeList, strings.Join(models.AllScopes, ","))
+	}
+
+	openDatabase()
+	user := findUser(username)
+
+	device, err := models.CreateDevice(user.ID, *name, "", "")
+	if err != nil {
+		fatalf("Failed to register device: %v", err)
+	}
+
+	var expiresAt *time.Time
+	if *days > 0 {
+		t := time.Now().AddDate(0, 0, *days)
+		expiresAt = &t
+	}
+
+	_, plaintext, err := models.CreateAPIToken(user.ID, device.ID, *name, scopes, expiresAt)
+	if err != nil {
+		fatalf("Failed to issue token: %v", err)
+	}
+
+	// 令牌单独输出到标准输出，便于脚本捕获
+	fmt.Fprintf(os.Stderr, "Issued token %q for %q with scopes %s\n", *name, user.Username, strings.Join(scopes, ","))
+	fmt.Println(plaintext)
+}
+
+// 解析参数，要求恰好一个用户名位置参数
+func parseUsernameArg(flags *flag.FlagSet, args []string) string {
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "Usage: weicopy %s [flags] <username>\n", flags.Name())
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+	return flags.Arg(0)
+}
+
+// 打开数据库并迁移，命令行工具不输出SQL日志，错误由各命令自行提示
+func openDatabase() {
+	if err := models.OpenDatabase(logger.Silent); err != nil {
+		fatalf("Failed to connect to database: %v", err)
+	}
+	if err := models.Migrate(); err != nil {
+		fatalf("Failed to migrate database: %v", err)
+	}
+}
+
+// 按用户名查找用户，不存在时退出
+func findUser(username string) *models.User {
+	user, err := models.FindUserByUsername(username)
+	if err != nil {
+		fatalf("User %q not found", username)
+	}
+	return user
+}
+
+// 读取新密码：在终端中不回显并要求确认，否则从标准输入读取一行，便于在容器中通过管道传入
+func readPassword() string {
+	password, err := readPasswordInput()
+	if err != nil {
+		fatalf("Failed to read password: %v", err)
+	}
+	if len(password) < 6 {
+		fatalf("Password must be at least 6 characters")
+	}
+	return password
+}
+
+// 从终端或标准输入读取密码
+func readPasswordInput() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprint(os.Stderr, "Confirm password: ")
+	confirm, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	if string(password) != string(confirm) {
+		return "", errors.New("passwords do not match")
+	}
+	return string(password), nil
+}
+
+// 输出错误信息并以非零状态退出
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -16,20 +18,43 @@ func GetJWTSecret() string {
 	return secret
 }
 
-// 获取JWT过期时间
-func GetJWTExpirationTime() time.Duration {
-	str := os.Getenv("JWT_EXPIRATION_HOURS")
+// 获取访问令牌（JWT）的有效期
+func GetAccessTokenExpirationTime() time.Duration {
+	str := os.Getenv("ACCESS_TOKEN_TTL_MINUTES")
 	if str == "" {
-		// 默认24小时
-		return 24 * time.Hour
+		// 默认15分钟
+		return 15 * time.Minute
 	}
 
-	hours, err := strconv.Atoi(str)
-	if err != nil {
-		return 24 * time.Hour
+	minutes, err := strconv.Atoi(str)
+	if err != nil || minutes <= 0 {
+		return 15 * time.Minute
 	}
 
-	return time.Duration(hours) * time.Hour
+	return time.Duration(minutes) * time.Minute
+}
+
+// LogDeprecations 对已不再生效的旧配置项输出警告，在服务启动时调用一次
+func LogDeprecations() {
+	if os.Getenv("JWT_EXPIRATION_HOURS") != "" {
+		log.Printf("Warning: JWT_EXPIRATION_HOURS is no longer supported and is ignored; access tokens now expire after ACCESS_TOKEN_TTL_MINUTES (currently %s) and sessions are kept alive by refresh tokens (REFRESH_TOKEN_TTL_DAYS)", GetAccessTokenExpirationTime())
+	}
+}
+
+// 获取刷新令牌的有效期，每次刷新后重新计算
+func GetRefreshTokenExpirationTime() time.Duration {
+	str := os.Getenv("REFRESH_TOKEN_TTL_DAYS")
+	if str == "" {
+		// 默认30天
+		return 30 * 24 * time.Hour
+	}
+
+	days, err := strconv.Atoi(str)
+	if err != nil || days <= 0 {
+		return 30 * 24 * time.Hour
+	}
+
+	return time.Duration(days) * 24 * time.Hour
 }
 
 // 获取数据库路径
@@ -50,6 +75,41 @@ func GetUploadPath() string {
 	return path
 }
 
+// 获取文件存储后端：local（默认，保存在上传目录）或s3
+func GetStorageBackend() string {
+	return strings.ToLower(strings.TrimSpace(os.Getenv("STORAGE_BACKEND")))
+}
+
+// 获取兼容S3的对象存储服务地址
+func GetS3Endpoint() string {
+	return os.Getenv("S3_ENDPOINT")
+}
+
+// 获取对象存储的区域，未设置时使用us-east-1
+func GetS3Region() string {
+	return os.Getenv("S3_REGION")
+}
+
+// 获取对象存储的存储桶名称
+func GetS3Bucket() string {
+	return os.Getenv("S3_BUCKET")
+}
+
+// 获取对象键的前缀
+func GetS3Prefix() string {
+	return os.Getenv("S3_PREFIX")
+}
+
+// 获取对象存储的访问密钥ID
+func GetS3AccessKeyID() string {
+	return os.Getenv("S3_ACCESS_KEY_ID")
+}
+
+// 获取对象存储的访问密钥
+func GetS3SecretAccessKey() string {
+	return os.Getenv("S3_SECRET_ACCESS_KEY")
+}
+
 // 获取最大上传文件大小（MB）
 func GetMaxUploadSize() int64 {
 	str := os.Getenv("MAX_UPLOAD_SIZE_MB")
@@ -66,6 +126,68 @@ func GetMaxUploadSize() int64 {
 	return size
 }
 
+// 获取新建剪贴板项目的默认保留时长，未设置或为0表示永久保留
+func GetDefaultItemTTL() time.Duration {
+	hours, err := strconv.Atoi(os.Getenv("DEFAULT_ITEM_TTL_HOURS"))
+	if err != nil || hours <= 0 {
+		return 0
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// 获取每个用户默认最多保留的未置顶项目数，未设置或为0表示不限
+func GetDefaultMaxHistoryItems() int {
+	limit, err := strconv.Atoi(os.Getenv("DEFAULT_MAX_HISTORY_ITEMS"))
+	if err != nil || limit <= 0 {
+		return 0
+	}
+	return limit
+}
+
+// 获取每个用户默认的存储空间配额（字节），未设置或为0表示不限
+func GetDefaultStorageQuota() int64 {
+	mb, err := strconv.ParseInt(os.Getenv("DEFAULT_STORAGE_QUOTA_MB"), 10, 64)
+	if err != nil || mb <= 0 {
+		return 0
+	}
+	return mb * 1024 * 1024
+}
+
+// 获取每个用户默认最多可保存的项目数，未设置或为0表示不限
+func GetDefaultItemQuota() int {
+	limit, err := strconv.Atoi(os.Getenv("DEFAULT_ITEM_QUOTA"))
+	if err != nil || limit <= 0 {
+		return 0
+	}
+	return limit
+}
+
+// 获取清理过期项目的后台任务执行间隔
+func GetRetentionSweepInterval() time.Duration {
+	return time.Duration(getPositiveInt("RETENTION_SWEEP_INTERVAL_SECONDS", 60)) * time.Second
+}
+
+// 获取签名下载链接的有效期
+func GetDownloadURLTTL() time.Duration {
+	return time.Duration(getPositiveInt("DOWNLOAD_URL_TTL_MINUTES", 15)) * time.Minute
+}
+
+// 获取WebSocket单条消息的最大大小（MB）
+func GetMaxWebSocketMessageSize() int64 {
+	str := os.Getenv("WS_MAX_MESSAGE_SIZE_MB")
+	if str == "" {
+		// 默认5MB
+		return 5
+	}
+
+	size, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return 5
+	}
+
+	return size
+}
+
 // 获取是否允许注册
 func IsRegistrationEnabled() bool {
 	str := os.Getenv("ENABLE_REGISTRATION")
@@ -81,3 +203,220 @@ func IsRegistrationEnabled() bool {
 
 	return enabled
 }
+
+// 获取TOTP验证器中显示的发行方名称
+func GetTOTPIssuer() string {
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		return "WeiCopy"
+	}
+	return issuer
+}
+
+// 获取OpenID Connect单点登录配置，未设置OIDC_ISSUER时单点登录关闭
+func GetOIDCIssuer() string {
+	return os.Getenv("OIDC_ISSUER")
+}
+
+// 获取在身份提供方注册的客户端ID
+func GetOIDCClientID() string {
+	return os.Getenv("OIDC_CLIENT_ID")
+}
+
+// 获取客户端密钥，公开客户端（仅使用PKCE）可留空
+func GetOIDCClientSecret() string {
+	return os.Getenv("OIDC_CLIENT_SECRET")
+}
+
+// 获取在身份提供方登记的回调地址，应指向/api/auth/oidc/callback
+func GetOIDCRedirectURL() string {
+	return os.Getenv("OIDC_REDIRECT_URL")
+}
+
+// 获取请求的OIDC权限范围
+func GetOIDCScopes() []string {
+	str := os.Getenv("OIDC_SCOPES")
+	if str == "" {
+		return []string{"openid", "profile", "email"}
+	}
+	return strings.Fields(str)
+}
+
+// 获取作为用户名的ID令牌声明
+func GetOIDCUsernameClaim() string {
+	claim := os.Getenv("OIDC_USERNAME_CLAIM")
+	if claim == "" {
+		return "preferred_username"
+	}
+	return claim
+}
+
+// 获取是否为首次登录的身份提供方用户自动创建账户
+func IsOIDCAutoProvisionEnabled() bool {
+	str := os.Getenv("OIDC_AUTO_PROVISION")
+	if str == "" {
+		// 默认不自动创建
+		return false
+	}
+
+	enabled, err := strconv.ParseBool(str)
+	if err != nil {
+		return false
+	}
+
+	return enabled
+}
+
+// 获取单点登录完成后跳转的前端地址，令牌通过URL片段传递
+func GetOIDCFrontendURL() string {
+	url := os.Getenv("OIDC_FRONTEND_URL")
+	if url == "" {
+		return "/login"
+	}
+	return url
+}
+
+// 获取登录使用的认证后端，多个后端以逗号分隔并按顺序尝试，默认仅使用本地密码
+func GetAuthBackends() []string {
+	str := os.Getenv("AUTH_BACKEND")
+	if str == "" {
+		return []string{"local"}
+	}
+
+	var backends []string
+	for _, name := range strings.Split(str, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			backends = append(backends, name)
+		}
+	}
+	return backends
+}
+
+// 获取LDAP服务器地址，如ldap://ldap.example.com:389或ldaps://ldap.example.com
+func GetLDAPURL() string {
+	return os.Getenv("LDAP_URL")
+}
+
+// 获取用于查找用户的服务账户DN，为空时匿名查找
+func GetLDAPBindDN() string {
+	return os.Getenv("LDAP_BIND_DN")
+}
+
+// 获取服务账户密码
+func GetLDAPBindPassword() string {
+	return os.Getenv("LDAP_BIND_PASSWORD")
+}
+
+// 获取查找用户的起始DN
+func GetLDAPBaseDN() string {
+	return os.Getenv("LDAP_BASE_DN")
+}
+
+// 获取查找用户的过滤器，%s替换为登录时输入的用户名
+func GetLDAPUserFilter() string {
+	filter := os.Getenv("LDAP_USER_FILTER")
+	if filter == "" {
+		return "(uid=%s)"
+	}
+	return filter
+}
+
+// 获取作为本地用户名的LDAP属性，为空时使用登录时输入的用户名
+func GetLDAPUsernameAttribute() string {
+	return os.Getenv("LDAP_USERNAME_ATTRIBUTE")
+}
+
+// 获取是否在连接后使用StartTLS加密
+func IsLDAPStartTLSEnabled() bool {
+	enabled, err := strconv.ParseBool(os.Getenv("LDAP_START_TLS"))
+	if err != nil {
+		return false
+	}
+	return enabled
+}
+
+// 获取是否为首次登录的目录用户自动创建账户
+func IsLDAPAutoProvisionEnabled() bool {
+	enabled, err := strconv.ParseBool(os.Getenv("LDAP_AUTO_PROVISION"))
+	if err != nil {
+		return false
+	}
+	return enabled
+}
+
+// 获取WebAuthn依赖方ID（站点域名），未设置时通行密钥登录关闭
+func GetWebAuthnRPID() string {
+	return os.Getenv("WEBAUTHN_RP_ID")
+}
+
+// 获取认证器中显示的依赖方名称
+func GetWebAuthnRPName() string {
+	name := os.Getenv("WEBAUTHN_RP_NAME")
+	if name == "" {
+		return "WeiCopy"
+	}
+	return name
+}
+
+// 获取允许发起WebAuthn请求的来源，多个以逗号分隔，默认为https://依赖方ID
+func GetWebAuthnOrigins() []string {
+	str := os.Getenv("WEBAUTHN_ORIGINS")
+	if str == "" {
+		return []string{"https://" + GetWebAuthnRPID()}
+	}
+
+	var origins []string
+	for _, origin := range strings.Split(str, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, strings.TrimSuffix(origin, "/"))
+		}
+	}
+	return origins
+}
+
+// 获取同一用户名在触发退避锁定前允许的连续登录失败次数
+func GetLoginMaxAttempts() int {
+	return getPositiveInt("LOGIN_MAX_ATTEMPTS", 5)
+}
+
+// 获取同一IP在触发退避锁定前允许的连续登录失败次数，不区分用户名
+func GetLoginMaxAttemptsPerIP() int {
+	return getPositiveInt("LOGIN_MAX_ATTEMPTS_PER_IP", 20)
+}
+
+// 获取登录锁定的最长时间，退避时长翻倍到该值后不再增加
+func GetLoginLockoutDuration() time.Duration {
+	return time.Duration(getPositiveInt("LOGIN_LOCKOUT_MINUTES", 15)) * time.Minute
+}
+
+// 获取可信反向代理的IP或CIDR列表，以逗号分隔
+// 只有来自这些地址的请求才会读取X-Forwarded-For中的客户端IP，未设置时直接使用连接的对端地址
+func GetTrustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// 获取启动时提升为管理员的用户名列表，以逗号分隔
+func GetAdminUsernames() []string {
+	var names []string
+	for _, name := range strings.Split(os.Getenv("ADMIN_USERNAMES"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// 读取正整数配置，未设置或无效时返回默认值
+func getPositiveInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
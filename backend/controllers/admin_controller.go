@@ -0,0 +1,338 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/weicopy/backend/middlewares"
+	"github.com/weicopy/backend/models"
+)
+
+// GetLoginLockouts 获取当前因登录失败而被锁定的用户名和IP
+func GetLoginLockouts(c *gin.Context) {
+	lockouts, err := models.GetLoginLockouts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed_to_fetch", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, lockouts)
+}
+
+// DeleteLoginLockout 解除锁定并清零失败计数
+func DeleteLoginLockout(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": "Invalid lockout ID"})
+		return
+	}
+
+	if err := models.DeleteLoginAttempt(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Lockout cleared successfully"})
+}
+
+// 创建邀请码的请求结构
+type CreateInviteRequest struct {
+	Note string `json:"note" binding:"max=255"`
+	// 注册用户获得的角色，为空时为普通用户
+	Role string `json:"role" binding:"omitempty,oneof=user admin"`
+	// 可使用次数，为空时为1，0表示不限次数
+	MaxUses *int `json:"max_uses" binding:"omitempty,min=0"`
+	// 有效小时数，为空或0表示永不过期
+	ExpiresInHours int `json:"expires_in_hours" binding:"min=0"`
+}
+
+// GetInvites 获取全部邀请码
+func GetInvites(c *gin.Context) {
+	invites, err := models.GetInvites()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed_to_fetch", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+// CreateInvite 创建邀请码，明文邀请码仅在创建时返回一次
+func CreateInvite(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	var req CreateInviteRequest
+	// 请求体可为空
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+			return
+		}
+	}
+
+	maxUses := 1
+	if req.MaxUses != nil {
+		maxUses = *req.MaxUses
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInHours > 0 {
+		t := time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour)
+		expiresAt = &t
+	}
+
+	role := req.Role
+	if role == "" {
+		role = models.RoleUser
+	}
+
+	invite, code, err := models.CreateInvite(user.ID, req.Note, role, maxUses, expiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "creation_failed", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    models.FormatInviteCode(code),
+		"details": invite,
+	})
+}
+
+// RevokeInvite 撤销邀请码
+func RevokeInvite(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": "Invalid invite ID"})
+		return
+	}
+
+	if err := models.RevokeInvite(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invite revoked successfully"})
+}
+
+// 创建用户的请求结构
+type CreateUserRequest struct {
+	Username string `json:"username" binding:"required,min=3,max=50"`
+	Password string `json:"password" binding:"required,min=6"`
+	Role     string `json:"role" binding:"omitempty,oneof=user admin"`
+}
+
+// 修改用户的请求结构，未提供的字段保持不变
+type UpdateUserRequest struct {
+	Role     *string `json:"role" binding:"omitempty,oneof=user admin"`
+	Disabled *bool   `json:"disabled"`
+}
+
+// 设置用户配额的请求结构，值为空时使用服务端配置，0表示不限
+type UpdateQuotaRequest struct {
+	StorageQuotaMB *int `json:"storage_quota_mb" binding:"omitempty,min=0"`
+	ItemQuota      *int `json:"item_quota" binding:"omitempty,min=0"`
+}
+
+// 重置密码的请求结构
+type ResetPasswordRequest struct {
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+// 管理接口返回的用户信息，附带存储用量
+type adminUserResponse struct {
+	models.User
+	Usage models.StorageUsage `json:"usage"`
+	Quota models.Quota        `json:"quota"`
+}
+
+// GetUsers 获取全部用户及其存储用量
+func GetUsers(c *gin.Context) {
+	users, err := models.GetUsers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed_to_fetch", "message": err.Error()})
+		return
+	}
+
+	usage, err := models.GetStorageUsage()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed_to_fetch", "message": err.Error()})
+		return
+	}
+
+	response := make([]adminUserResponse, 0, len(users))
+	for _, user := range users {
+		userUsage := usage[user.ID]
+		userUsage.UserID = user.ID
+		response = append(response, adminUserResponse{User: user, Usage: userUsage, Quota: models.GetUserQuota(&user)})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateUser 由管理员直接创建用户，不受开放注册开关限制
+func CreateUser(c *gin.Context) {
+	var req CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	if _, err := models.FindUserByUsername(req.Username); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "username_taken", "message": "Username is already taken"})
+		return
+	}
+
+	role := req.Role
+	if role == "" {
+		role = models.RoleUser
+	}
+
+	user, err := models.CreateUserWithRole(req.Username, req.Password, role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "creation_failed", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, user)
+}
+
+// UpdateUser 修改用户角色或停用、启用用户
+func UpdateUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": "Invalid user ID"})
+		return
+	}
+
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	if req.Role != nil {
+		if err := models.UpdateUserRole(uint(id), *req.Role); err != nil {
+			respondUserUpdateError(c, err)
+			return
+		}
+	}
+
+	if req.Disabled != nil {
+		if err := models.SetUserDisabled(uint(id), *req.Disabled); err != nil {
+			respondUserUpdateError(c, err)
+			return
+		}
+	}
+
+	user, err := models.FindUserByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// ResetUserPassword 重置用户密码，并使其全部会话失效
+func ResetUserPassword(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": "Invalid user ID"})
+		return
+	}
+
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	if err := models.ResetUserPassword(uint(id), req.Password); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
+
+// UpdateUserQuota 设置用户的存储空间和项目数配额，已保存的项目不受影响
+func UpdateUserQuota(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": "Invalid user ID"})
+		return
+	}
+
+	var req UpdateQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	if err := models.UpdateUserQuota(uint(id), req.StorageQuotaMB, req.ItemQuota); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": err.Error()})
+		return
+	}
+
+	user, err := models.FindUserByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user, "quota": models.GetUserQuota(user)})
+}
+
+// DeleteUser 删除用户及其全部剪贴板项目、文件、设备和令牌
+func DeleteUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": "Invalid user ID"})
+		return
+	}
+
+	if err := models.DeleteUser(uint(id)); err != nil {
+		respondUserUpdateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+}
+
+// GetUserUsage 获取单个用户的存储用量
+func GetUserUsage(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": "Invalid user ID"})
+		return
+	}
+
+	if _, err := models.FindUserByID(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": err.Error()})
+		return
+	}
+
+	usage, err := models.GetUserStorageUsage(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed_to_fetch", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+// 将修改用户时的错误转换为响应
+func respondUserUpdateError(c *gin.Context, err error) {
+	if errors.Is(err, models.ErrLastAdmin) {
+		c.JSON(http.StatusConflict, gin.H{"error": "last_admin", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": err.Error()})
+}
@@ -1,33 +1,63 @@
 package controllers
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/weicopy/backend/authenticators"
 	"github.com/weicopy/backend/config"
 	"github.com/weicopy/backend/middlewares"
 	"github.com/weicopy/backend/models"
 )
 
+// 重新认证令牌的受众和有效期
+const (
+	reauthAudience = "weicopy:reauth"
+	reauthTokenTTL = 5 * time.Minute
+)
+
+// 修改密码的请求结构
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=6"`
+}
+
+// 用户设置的请求结构
+type UpdateSettingsRequest struct {
+	// 新建项目的默认保留小时数，为空时使用服务端配置，0表示永久保留
+	ItemTTLHours *int `json:"item_ttl_hours" binding:"omitempty,min=0"`
+	// 最多保留的未置顶项目数，为空时使用服务端配置，0表示不限
+	MaxHistoryItems *int `json:"max_history_items" binding:"omitempty,min=0"`
+}
+
+// 敏感操作的重新认证凭据，有密码的账户提供密码，只能通过单点登录的账户提供重新认证令牌
+type ReauthRequest struct {
+	Password    string `json:"password"`
+	ReauthToken string `json:"reauth_token"`
+}
+
+// 注销账户的请求结构，需再次认证确认
+type DeleteAccountRequest struct {
+	ReauthRequest
+}
+
 // 用于登录和注册的请求结构
 type AuthRequest struct {
 	Username string `json:"username" binding:"required,min=3,max=50"`
 	Password string `json:"password" binding:"required,min=6"`
+	// 登录时可选的设备名称，用于在设备列表中区分
+	DeviceName string `json:"device_name" binding:"max=100"`
+	// 注册时可选的邀请码，未开放注册时必须提供
+	InviteCode string `json:"invite_code"`
 }
 
 // Register 处理用户注册
 func Register(c *gin.Context) {
-	// 检查是否允许注册
-	if !config.IsRegistrationEnabled() {
-		c.JSON(http.StatusForbidden, gin.H{
-			"error":   "registration_disabled",
-			"message": "Registration is currently disabled",
-		})
-		return
-	}
-
 	var req AuthRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -37,6 +67,15 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	// 检查是否允许注册，持有邀请码时不受开放注册开关限制
+	if !config.IsRegistrationEnabled() && req.InviteCode == "" {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "registration_disabled",
+			"message": "Registration is currently disabled",
+		})
+		return
+	}
+
 	// 检查用户名是否已存在
 	_, err := models.FindUserByUsername(req.Username)
 	if err == nil {
@@ -48,8 +87,25 @@ func Register(c *gin.Context) {
 	}
 
 	// 创建新用户
-	user, err := models.CreateUser(req.Username, req.Password)
+	var user *models.User
+	if req.InviteCode != "" {
+		user, err = models.CreateUserWithInvite(req.Username, req.Password, req.InviteCode)
+	} else {
+		// 开放注册时第一个注册的用户成为管理员
+		role := models.RoleUser
+		if count, countErr := models.CountUsers(); countErr == nil && count == 0 {
+			role = models.RoleAdmin
+		}
+		user, err = models.CreateUserWithRole(req.Username, req.Password, role)
+	}
 	if err != nil {
+		if errors.Is(err, models.ErrInvalidInvite) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "invalid_invite",
+				"message": "Invalid or expired invite code",
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "registration_failed",
 			"message": "Failed to create user",
@@ -77,27 +133,101 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// 查找用户
-	user, err := models.FindUserByUsername(req.Username)
+	// 连续失败过多时拒绝尝试，不再执行密码校验
+	if !checkLoginThrottle(c, req.Username) {
+		return
+	}
+
+	// 通过配置的认证后端验证用户名和密码
+	user, err := authenticators.Default().Authenticate(req.Username, req.Password)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error":   "invalid_credentials",
-			"message": "Invalid username or password",
+		if errors.Is(err, authenticators.ErrInvalidCredentials) {
+			recordLoginFailure(c, req.Username)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":   "invalid_credentials",
+				"message": "Invalid username or password",
+			})
+			return
+		}
+		// 后端不可用时同样计入失败次数，避免借此绕过登录限制
+		recordLoginFailure(c, req.Username)
+		log.Printf("auth: login failed for %q: %v", req.Username, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":   "auth_backend_unavailable",
+			"message": "Authentication service is temporarily unavailable",
 		})
 		return
 	}
 
-	// 验证密码
-	if err := user.CheckPassword(req.Password); err != nil {
+	// 密码正确后才提示账户已停用，避免泄露账户状态
+	if !checkUserEnabled(c, user) {
+		return
+	}
+
+	// 启用了两步验证时先签发挑战令牌，验证码校验通过后才签发访问令牌
+	if user.TOTPEnabled {
+		challenge, err := generateTwoFactorChallenge(user.ID, req.DeviceName)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "token_generation_failed",
+				"message": "Failed to generate token",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+			"expires_in":          int(twoFactorChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	clearLoginFailures(req.Username)
+
+	// 创建会话并生成令牌
+	tokens, err := issueTokens(c, user, req.DeviceName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "token_generation_failed",
+			"message": "Failed to generate token",
+		})
+		return
+	}
+
+	tokens["user"] = gin.H{
+		"id":       user.ID,
+		"username": user.Username,
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// 用于刷新令牌的请求结构
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// Refresh 使用刷新令牌换取新的访问令牌，刷新令牌同时轮换
+func Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	session, refreshToken, err := models.RotateSession(req.RefreshToken, config.GetRefreshTokenExpirationTime())
+	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{
-			"error":   "invalid_credentials",
-			"message": "Invalid username or password",
+			"error":   "invalid_refresh_token",
+			"message": err.Error(),
 		})
 		return
 	}
 
-	// 生成JWT令牌
-	token, err := generateToken(user.ID)
+	token, err := generateToken(session.UserID, session.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "token_generation_failed",
@@ -107,14 +237,65 @@ func Login(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-		},
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int(config.GetAccessTokenExpirationTime().Seconds()),
 	})
 }
 
+// Logout 退出当前会话
+func Logout(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "unauthorized",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	session, err := middlewares.GetCurrentSession(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := models.RevokeSession(session.ID, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "logout_failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// LogoutAll 退出该用户的全部会话，所有已签发的访问令牌立即失效
+func LogoutAll(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "unauthorized",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := models.RevokeAllSessions(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "logout_failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "All sessions logged out successfully"})
+}
+
 // GetCurrentUser 获取当前登录用户信息
 func GetCurrentUser(c *gin.Context) {
 	user, err := middlewares.GetCurrentUser(c)
@@ -126,19 +307,325 @@ func GetCurrentUser(c *gin.Context) {
 		return
 	}
 
+	usage, err := models.GetUserStorageUsage(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_fetch",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":                user.ID,
+		"username":          user.Username,
+		"role":              user.Role,
+		"totp_enabled":      user.TOTPEnabled,
+		"has_password":      user.HasLocalPassword(),
+		"item_ttl_hours":    user.ItemTTLHours,
+		"max_history_items": user.MaxHistoryItems,
+		"usage":             usage,
+		"quota":             models.GetUserQuota(user),
+		"created_at":        user.CreatedAt,
+	})
+}
+
+// UpdateSettings 修改当前用户的设置
+func UpdateSettings(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "unauthorized",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var req UpdateSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := models.UpdateUserSettings(user.ID, req.ItemTTLHours, req.MaxHistoryItems); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "update_failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"id":         user.ID,
-		"username":   user.Username,
-		"created_at": user.CreatedAt,
+		"item_ttl_hours":    req.ItemTTLHours,
+		"max_history_items": req.MaxHistoryItems,
+	})
+}
+
+// ChangePassword 修改当前用户的密码，并退出除当前会话外的全部会话
+func ChangePassword(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "unauthorized",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// 外部身份用户的密码由身份提供方或LDAP目录管理，设置本地密码会绕过外部的账户策略
+	if !user.HasLocalPassword() {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "externally_managed",
+			"message": "The password of this account is managed by an external identity provider",
+		})
+		return
+	}
+
+	if !reauthenticate(c, user, ReauthRequest{Password: req.CurrentPassword}, "Current password is incorrect") {
+		return
+	}
+
+	// 使用个人访问令牌时不存在当前会话，全部会话都会退出
+	var keepSessionID string
+	if session, err := middlewares.GetCurrentSession(c); err == nil {
+		keepSessionID = session.ID
+	}
+
+	if err := models.ChangePassword(user.ID, req.NewPassword, keepSessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "update_failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+}
+
+// DeleteAccount 注销当前用户，删除其全部剪贴板项目、上传的文件、设备和令牌
+func DeleteAccount(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "unauthorized",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if !reauthenticate(c, user, req.ReauthRequest, "Invalid password") {
+		return
+	}
+
+	if err := models.DeleteUser(user.ID); err != nil {
+		if errors.Is(err, models.ErrLastAdmin) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "last_admin",
+				"message": "Promote another administrator before deleting this account",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "deletion_failed",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted successfully"})
+}
+
+// 检查用户是否已被停用，已停用时返回403
+func checkUserEnabled(c *gin.Context, user *models.User) bool {
+	if !user.IsDisabled() {
+		return true
+	}
+
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":   "account_disabled",
+		"message": "This account has been disabled",
 	})
+	return false
+}
+
+// 修改密码、注销账户等敏感操作前重新认证当前用户，失败时写入响应并返回false
+// 密码与登录相同通过配置的认证后端校验，LDAP用户使用目录密码；只能通过单点登录的账户没有可校验的密码，
+// 需先调用/api/auth/oidc/reauth在身份提供方重新登录，再提交获得的重新认证令牌
+// 失败次数与登录共用计数，锁定期间同样返回429
+func reauthenticate(c *gin.Context, user *models.User, req ReauthRequest, invalidMessage string) bool {
+	if !checkLoginThrottle(c, user.Username) {
+		return false
+	}
+
+	if req.ReauthToken != "" {
+		if err := parseReauthToken(req.ReauthToken, user.ID); err != nil {
+			recordLoginFailure(c, user.Username)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":   "invalid_reauth_token",
+				"message": "Re-authentication token is invalid or expired",
+			})
+			return false
+		}
+		clearLoginFailures(user.Username)
+		return true
+	}
+
+	if !user.HasLocalPassword() {
+		directory, err := hasDirectoryIdentity(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "failed_to_fetch",
+				"message": err.Error(),
+			})
+			return false
+		}
+		if !directory {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "reauthentication_required",
+				"message": "This account signs in through an external identity provider, sign in again through /api/auth/oidc/reauth to confirm",
+			})
+			return false
+		}
+	}
+
+	if req.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": "Password is required",
+		})
+		return false
+	}
+
+	authenticated, err := authenticators.Default().Authenticate(user.Username, req.Password)
+	if err != nil && !errors.Is(err, authenticators.ErrInvalidCredentials) {
+		// 与登录相同，后端错误也计入失败次数，避免借此绕过锁定
+		recordLoginFailure(c, user.Username)
+		log.Printf("auth: re-authentication failed for %q: %v", user.Username, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":   "auth_backend_unavailable",
+			"message": "Authentication service is temporarily unavailable",
+		})
+		return false
+	}
+	// 认证后端可能将用户名映射到其他本地用户，必须是当前用户本人
+	if err != nil || authenticated.ID != user.ID {
+		recordLoginFailure(c, user.Username)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "invalid_credentials",
+			"message": invalidMessage,
+		})
+		return false
+	}
+
+	clearLoginFailures(user.Username)
+	return true
+}
+
+// 生成重新认证令牌，只能由同一用户在有效期内用于敏感操作
+func generateReauthToken(userID uint) (string, error) {
+	now := time.Now()
+	claims := &jwt.RegisteredClaims{
+		Subject:   strconv.FormatUint(uint64(userID), 10),
+		Audience:  jwt.ClaimStrings{reauthAudience},
+		ExpiresAt: jwt.NewNumericDate(now.Add(reauthTokenTTL)),
+		IssuedAt:  jwt.NewNumericDate(now),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(config.GetJWTSecret()))
+}
+
+// 校验重新认证令牌属于指定用户且未过期
+func parseReauthToken(tokenString string, userID uint) error {
+	claims := &jwt.RegisteredClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(config.GetJWTSecret()), nil
+	})
+	if err != nil || !token.Valid {
+		return errors.New("invalid reauth token")
+	}
+
+	if !claims.VerifyAudience(reauthAudience, true) || claims.Subject != strconv.FormatUint(uint64(userID), 10) {
+		return errors.New("invalid reauth token")
+	}
+
+	return nil
+}
+
+// 用户是否关联了LDAP目录中的身份
+func hasDirectoryIdentity(userID uint) (bool, error) {
+	identities, err := models.GetUserIdentities(userID)
+	if err != nil {
+		return false, err
+	}
+	for _, identity := range identities {
+		if authenticators.IsDirectoryIssuer(identity.Issuer) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// 为用户登记新设备并创建会话，返回访问令牌和刷新令牌
+func issueTokens(c *gin.Context, user *models.User, deviceName string) (gin.H, error) {
+	if deviceName == "" {
+		deviceName = c.Request.UserAgent()
+	}
+	device, err := models.CreateDevice(user.ID, deviceName, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		return nil, err
+	}
+
+	session, refreshToken, err := models.CreateSession(user.ID, device.ID, c.Request.UserAgent(), c.ClientIP(),
+		config.GetRefreshTokenExpirationTime())
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := generateToken(user.ID, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int(config.GetAccessTokenExpirationTime().Seconds()),
+		"device_id":     device.ID,
+	}, nil
 }
 
-// 生成JWT令牌
-func generateToken(userID uint) (string, error) {
-	expirationTime := time.Now().Add(config.GetJWTExpirationTime())
+// 生成JWT访问令牌
+func generateToken(userID uint, sessionID string) (string, error) {
+	expirationTime := time.Now().Add(config.GetAccessTokenExpirationTime())
 
 	claims := &middlewares.Claims{
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
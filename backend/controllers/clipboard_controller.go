@@ -1,18 +1,24 @@
 package controllers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/weicopy/backend/config"
+	"github.com/weicopy/backend/events"
 	"github.com/weicopy/backend/middlewares"
 	"github.com/weicopy/backend/models"
+	"github.com/weicopy/backend/storage"
 )
 
 // GetClipboardItems 获取用户的所有剪贴板项目
@@ -32,7 +38,11 @@ func GetClipboardItems(c *gin.Context) {
 	c.JSON(http.StatusOK, items)
 }
 
+// 长轮询的最长等待时间
+const maxLatestWait = 5 * time.Minute
+
 // GetLatestClipboardItem 获取用户的最新剪贴板项目
+// 支持 ?wait=30s&after=<item-id> 长轮询：阻塞直到出现比after更新的项目，超时返回204
 func GetLatestClipboardItem(c *gin.Context) {
 	user, err := middlewares.GetCurrentUser(c)
 	if err != nil {
@@ -40,19 +50,82 @@ func GetLatestClipboardItem(c *gin.Context) {
 		return
 	}
 
-	item, err := models.GetLatestClipboardItemByUserID(user.ID)
-	if err != nil {
-		if err.Error() == "no clipboard items found" {
-			c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": "No clipboard items found"})
+	var wait time.Duration
+	if str := c.Query("wait"); str != "" {
+		wait, err = parseWaitDuration(str)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": "Invalid wait duration"})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed_to_fetch", "message": err.Error()})
+	}
+
+	if wait <= 0 {
+		item, err := models.GetLatestClipboardItemByUserID(user.ID)
+		if err != nil {
+			if err.Error() == "no clipboard items found" {
+				c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": "No clipboard items found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed_to_fetch", "message": err.Error()})
+			return
+		}
+		writeLatestItem(c, item)
 		return
 	}
 
+	// 先订阅再查询数据库，避免错过查询与等待之间创建的项目
+	sub := events.Subscribe(user.ID)
+	defer func() { sub.Close() }()
+
+	after := c.Query("after")
+	var afterItem *models.ClipboardItem
+	if after != "" {
+		// 参照项目可能已被删除，此时只要求最新项目不是它本身
+		if item, err := models.GetClipboardItemByID(after); err == nil && item.UserID == user.ID {
+			afterItem = item
+		}
+	}
+
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+
+	for {
+		item, err := models.GetLatestClipboardItemByUserID(user.ID)
+		if err != nil && err.Error() != "no clipboard items found" {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed_to_fetch", "message": err.Error()})
+			return
+		}
+		if err == nil && item.ID != after &&
+			(afterItem == nil || item.Seq > afterItem.Seq) {
+			writeLatestItem(c, item)
+			return
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-timeout.C:
+			c.Status(http.StatusNoContent)
+			return
+		case _, ok := <-sub.C:
+			if !ok {
+				// 订阅被关闭，重新订阅后继续等待
+				sub = resubscribe(sub, user.ID)
+			}
+		}
+	}
+}
+
+// 按项目类型写出最新项目，并通过X-Item-ID头部返回项目ID供下一次长轮询使用
+func writeLatestItem(c *gin.Context, item *models.ClipboardItem) {
+	c.Header("X-Item-ID", item.ID)
+
 	// 根据类型返回不同的响应
 	switch item.Type {
 	case models.TypeText:
+		if ok, _ := consumeItemRead(c, item); !ok {
+			return
+		}
 		c.String(http.StatusOK, item.Content)
 	case models.TypeImage, models.TypeFile:
 		c.Redirect(http.StatusFound, fmt.Sprintf("/api/clipboard/file/%s", item.ID))
@@ -61,6 +134,95 @@ func GetLatestClipboardItem(c *gin.Context) {
 	}
 }
 
+// 解析等待时间，支持"30s"形式的时长或纯秒数，最长不超过maxLatestWait
+func parseWaitDuration(str string) (time.Duration, error) {
+	wait, err := time.ParseDuration(str)
+	if err != nil {
+		seconds, convErr := strconv.Atoi(str)
+		if convErr != nil {
+			return 0, err
+		}
+		wait = time.Duration(seconds) * time.Second
+	}
+	if wait < 0 {
+		return 0, errors.New("wait duration must not be negative")
+	}
+	if wait > maxLatestWait {
+		wait = maxLatestWait
+	}
+	return wait, nil
+}
+
+func resubscribe(sub *events.Subscription, userID uint) *events.Subscription {
+	sub.Close()
+	return events.Subscribe(userID)
+}
+
+// 变更查询的默认和最大返回条数
+const (
+	defaultChangesLimit = 100
+	maxChangesLimit     = 1000
+)
+
+// GetClipboardChanges 获取游标之后的变更（创建和删除），供离线设备增量同步
+func GetClipboardChanges(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	var since uint64
+	if str := c.Query("since"); str != "" {
+		since, err = strconv.ParseUint(str, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": "Invalid since cursor"})
+			return
+		}
+	}
+
+	limit := defaultChangesLimit
+	if str := c.Query("limit"); str != "" {
+		limit, err = strconv.Atoi(str)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": "Invalid limit"})
+			return
+		}
+		if limit > maxChangesLimit {
+			limit = maxChangesLimit
+		}
+	}
+
+	seq, err := models.GetClipboardSeq(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed_to_fetch", "message": err.Error()})
+		return
+	}
+
+	// 游标超过当前序号，说明客户端的同步状态已失效，需要重新全量同步
+	if since > seq {
+		c.JSON(http.StatusGone, gin.H{"error": "cursor_expired", "message": "Cursor is ahead of server state, please resync"})
+		return
+	}
+
+	changes, hasMore, err := models.GetClipboardChanges(user.ID, since, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed_to_fetch", "message": err.Error()})
+		return
+	}
+
+	cursor := since
+	if len(changes) > 0 {
+		cursor = changes[len(changes)-1].Seq
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"changes":  changes,
+		"cursor":   cursor,
+		"has_more": hasMore,
+	})
+}
+
 // AddTextItem 添加文本类型的剪贴板项目
 func AddTextItem(c *gin.Context) {
 	user, err := middlewares.GetCurrentUser(c)
@@ -81,13 +243,21 @@ func AddTextItem(c *gin.Context) {
 		return
 	}
 
+	opts, err := parseItemOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
 	// 创建文本项目
-	item, err := models.CreateTextItem(user.ID, string(body))
+	item, trimmed, err := models.CreateTextItem(user.ID, middlewares.GetCurrentDeviceID(c), string(body), opts)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "creation_failed", "message": err.Error()})
+		respondCreateError(c, err)
 		return
 	}
 
+	publishCreatedItem(user.ID, item, trimmed)
+
 	c.JSON(http.StatusCreated, item)
 }
 
@@ -110,32 +280,36 @@ func UploadFile(c *gin.Context) {
 	}
 	defer file.Close()
 
-	// 保存文件
-	filename := header.Filename
-	extension := filepath.Ext(filename)
-	newFilename := uuid.New().String() + extension
-	filePath := filepath.Join(config.GetUploadPath(), newFilename)
-
-	out, err := os.Create(filePath)
+	opts, err := parseItemOptions(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "file_save_failed", "message": "Failed to save file"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	// 写入文件前按声明的大小检查配额
+	if err := models.CheckStorageQuota(user.ID, header.Size); err != nil {
+		respondCreateError(c, err)
 		return
 	}
-	defer out.Close()
 
-	_, err = io.Copy(out, file)
+	// 保存文件
+	filename := header.Filename
+	fileKey, err := saveUploadedFile(c.Request.Context(), file, header.Size, filepath.Ext(filename))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "file_save_failed", "message": "Failed to save file"})
 		return
 	}
 
 	// 创建文件项目
-	item, err := models.CreateFileItem(user.ID, filename, filePath, false)
+	item, trimmed, err := models.CreateFileItem(user.ID, middlewares.GetCurrentDeviceID(c), filename, fileKey, header.Size, false, opts)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "creation_failed", "message": err.Error()})
+		models.DeleteStoredFile(fileKey)
+		respondCreateError(c, err)
 		return
 	}
 
+	publishCreatedItem(user.ID, item, trimmed)
+
 	c.JSON(http.StatusCreated, item)
 }
 
@@ -158,6 +332,12 @@ func UploadImage(c *gin.Context) {
 	}
 	defer file.Close()
 
+	opts, err := parseItemOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
 	// 检查文件类型
 	contentType := header.Header.Get("Content-Type")
 	if !strings.HasPrefix(contentType, "image/") {
@@ -165,49 +345,36 @@ func UploadImage(c *gin.Context) {
 		return
 	}
 
+	// 写入文件前按声明的大小检查配额
+	if err := models.CheckStorageQuota(user.ID, header.Size); err != nil {
+		respondCreateError(c, err)
+		return
+	}
+
 	// 保存文件
 	filename := header.Filename
 	extension := filepath.Ext(filename)
 	if extension == "" {
-		// 根据MIME类型推断扩展名
-		switch contentType {
-		case "image/jpeg":
-			extension = ".jpg"
-		case "image/png":
-			extension = ".png"
-		case "image/gif":
-			extension = ".gif"
-		case "image/webp":
-			extension = ".webp"
-		default:
-			extension = ".bin"
-		}
+		extension = imageExtension(contentType)
 		filename = "image" + extension
 	}
 
-	newFilename := uuid.New().String() + extension
-	filePath := filepath.Join(config.GetUploadPath(), newFilename)
-
-	out, err := os.Create(filePath)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "file_save_failed", "message": "Failed to save file"})
-		return
-	}
-	defer out.Close()
-
-	_, err = io.Copy(out, file)
+	fileKey, err := saveUploadedFile(c.Request.Context(), file, header.Size, extension)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "file_save_failed", "message": "Failed to save file"})
 		return
 	}
 
 	// 创建图片项目
-	item, err := models.CreateFileItem(user.ID, filename, filePath, true)
+	item, trimmed, err := models.CreateFileItem(user.ID, middlewares.GetCurrentDeviceID(c), filename, fileKey, header.Size, true, opts)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "creation_failed", "message": err.Error()})
+		models.DeleteStoredFile(fileKey)
+		respondCreateError(c, err)
 		return
 	}
 
+	publishCreatedItem(user.ID, item, trimmed)
+
 	c.JSON(http.StatusCreated, item)
 }
 
@@ -238,20 +405,149 @@ func GetFile(c *gin.Context) {
 		return
 	}
 
+	serveItemFile(c, item)
+}
+
+// 提供项目内容：文件和图片返回文件，文本返回内容（用于读取阅后即焚的文本）
+// 阅后即焚项目每次读取都会计数，最后一次读取后删除项目和文件
+func serveItemFile(c *gin.Context, item *models.ClipboardItem) {
+	// 签名链接无需认证即可访问，与分享链接相同禁止内容嗅探，并在沙箱中处理以免上传的内容执行脚本
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "sandbox")
+
+	if item.Type == models.TypeText {
+		if ok, _ := consumeItemRead(c, item); !ok {
+			return
+		}
+		c.String(http.StatusOK, item.Content)
+		return
+	}
+
 	// 检查类型
 	if item.Type != models.TypeFile && item.Type != models.TypeImage {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_item_type", "message": "Item is not a file or image"})
 		return
 	}
 
-	// 检查文件是否存在
-	if _, err := os.Stat(item.FilePath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "file_not_found", "message": "File not found on server"})
+	file, err := storage.Open(c.Request.Context(), storage.Default, item.FilePath)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotExist) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "file_not_found", "message": "File not found on server"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "file_read_failed", "message": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	ok, deleted := consumeItemRead(c, item)
+	if !ok {
 		return
 	}
+	if deleted {
+		// 对象存储在发送时才读取内容，最后一次读取的文件在响应完成后再删除
+		defer models.DeleteStoredFile(item.FilePath)
+	}
+
+	setFileContentHeaders(c, item)
+	http.ServeContent(c.Writer, c.Request, path.Base(item.FilePath), file.ModTime(), file)
+}
+
+// 记录阅后即焚项目的一次读取，达到次数后删除项目并通知其他设备，deleted表示文件需由调用方删除
+// 项目已被读完时写出404并返回false；普通项目直接返回true
+func consumeItemRead(c *gin.Context, item *models.ClipboardItem) (ok, deleted bool) {
+	if !item.IsBurnAfterRead() {
+		return true, false
+	}
+
+	tombstone, err := models.ConsumeClipboardItemRead(item)
+	if err != nil {
+		if errors.Is(err, models.ErrItemConsumed) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": "Item not found"})
+			return false, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed_to_fetch", "message": err.Error()})
+		return false, false
+	}
+
+	if tombstone != nil {
+		events.Publish(item.UserID, models.DeletedChange(tombstone))
+	}
+
+	// 内容只能读取有限次数，禁止缓存
+	c.Header("Cache-Control", "no-store")
+	return true, tombstone != nil
+}
+
+// 从查询参数、表单字段或请求头读取项目设置：burn_after_read=true等同于max_reads=1
+func parseItemOptions(c *gin.Context) (models.ItemOptions, error) {
+	var opts models.ItemOptions
+
+	if value := itemParam(c, "max_reads", "X-Max-Reads"); value != "" {
+		maxReads, err := strconv.Atoi(value)
+		if err != nil || maxReads < 0 {
+			return opts, errors.New("max_reads must be a non-negative integer")
+		}
+		opts.MaxReads = maxReads
+	}
+
+	if value := itemParam(c, "burn_after_read", "X-Burn-After-Read"); value != "" {
+		burn, err := strconv.ParseBool(value)
+		if err != nil {
+			return opts, errors.New("burn_after_read must be a boolean")
+		}
+		if burn && opts.MaxReads == 0 {
+			opts.MaxReads = 1
+		}
+	}
 
-	// 提供文件下载
-	c.File(item.FilePath)
+	// 过期时间：expires_in为相对时长（如"1h"或秒数），expires_at为RFC 3339时间
+	if value := itemParam(c, "expires_in", "X-Expires-In"); value != "" {
+		ttl, err := parseItemTTL(value)
+		if err != nil {
+			return opts, err
+		}
+		expiresAt := time.Now().Add(ttl)
+		opts.ExpiresAt = &expiresAt
+	} else if value := itemParam(c, "expires_at", "X-Expires-At"); value != "" {
+		expiresAt, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return opts, errors.New("expires_at must be an RFC 3339 timestamp")
+		}
+		if !expiresAt.After(time.Now()) {
+			return opts, errors.New("expires_at must be in the future")
+		}
+		opts.ExpiresAt = &expiresAt
+	}
+
+	return opts, nil
+}
+
+// 依次从查询参数、表单字段和请求头读取项目设置
+func itemParam(c *gin.Context, key, header string) string {
+	if value := c.Query(key); value != "" {
+		return value
+	}
+	if value := c.PostForm(key); value != "" {
+		return value
+	}
+	return c.GetHeader(header)
+}
+
+// 解析项目保留时长，支持"1h30m"形式的时长或纯秒数
+func parseItemTTL(str string) (time.Duration, error) {
+	ttl, err := time.ParseDuration(str)
+	if err != nil {
+		seconds, convErr := strconv.Atoi(str)
+		if convErr != nil {
+			return 0, errors.New("expires_in must be a duration such as 1h or a number of seconds")
+		}
+		ttl = time.Duration(seconds) * time.Second
+	}
+	if ttl <= 0 {
+		return 0, errors.New("expires_in must be positive")
+	}
+	return ttl, nil
 }
 
 // DeleteClipboardItem 删除剪贴板项目
@@ -274,16 +570,105 @@ func DeleteClipboardItem(c *gin.Context) {
 		// 检查所有权
 		if item.UserID == user.ID {
 			// 尝试删除文件（忽略错误）
-			os.Remove(item.FilePath)
+			models.DeleteStoredFile(item.FilePath)
 		}
 	}
 
 	// 删除数据库记录
-	err = models.DeleteClipboardItem(id, user.ID)
+	tombstone, err := models.DeleteClipboardItem(id, user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "deletion_failed", "message": err.Error()})
 		return
 	}
 
+	events.Publish(user.ID, models.DeletedChange(tombstone))
+
 	c.JSON(http.StatusOK, gin.H{"message": "Item deleted successfully"})
 }
+
+// 更新剪贴板项目的请求结构
+type UpdateClipboardItemRequest struct {
+	Pinned *bool `json:"pinned" binding:"required"`
+}
+
+// UpdateClipboardItem 修改剪贴板项目，目前支持置顶和取消置顶
+func UpdateClipboardItem(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	var req UpdateClipboardItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	item, err := models.SetClipboardItemPinned(c.Param("id"), user.ID, *req.Pinned)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": err.Error()})
+		return
+	}
+
+	// 修改后的项目以新的序号作为创建变更重新下发，客户端按ID覆盖
+	events.Publish(user.ID, models.CreatedChange(item))
+
+	c.JSON(http.StatusOK, item)
+}
+
+// 将创建项目时的错误转换为响应，超出配额时返回507
+func respondCreateError(c *gin.Context, err error) {
+	c.JSON(createErrorStatus(err), gin.H{"error": createErrorCode(err), "message": err.Error()})
+}
+
+func createErrorStatus(err error) int {
+	if errors.Is(err, models.ErrStorageQuotaExceeded) || errors.Is(err, models.ErrItemQuotaExceeded) {
+		return http.StatusInsufficientStorage
+	}
+	return http.StatusInternalServerError
+}
+
+func createErrorCode(err error) string {
+	switch {
+	case errors.Is(err, models.ErrStorageQuotaExceeded):
+		return "storage_quota_exceeded"
+	case errors.Is(err, models.ErrItemQuotaExceeded):
+		return "item_quota_exceeded"
+	default:
+		return "creation_failed"
+	}
+}
+
+// 推送新建项目的事件，以及因超出历史数量上限而被删除的项目
+func publishCreatedItem(userID uint, item *models.ClipboardItem, trimmed []*models.ClipboardTombstone) {
+	for _, tombstone := range trimmed {
+		events.Publish(userID, models.DeletedChange(tombstone))
+	}
+	events.Publish(userID, models.CreatedChange(item))
+}
+
+// 将上传内容以随机文件名保存到存储后端，返回文件的键
+func saveUploadedFile(ctx context.Context, src io.Reader, size int64, extension string) (string, error) {
+	key := uuid.New().String() + extension
+	if err := storage.Default.Put(ctx, key, src, size); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// 根据MIME类型推断图片扩展名
+func imageExtension(contentType string) string {
+	switch contentType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	default:
+		return ".bin"
+	}
+}
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/weicopy/backend/middlewares"
+	"github.com/weicopy/backend/models"
+)
+
+// 修改设备的请求结构
+type UpdateDeviceRequest struct {
+	Name string `json:"name" binding:"required,min=1,max=100"`
+}
+
+// GetDevices 获取当前用户的设备列表
+func GetDevices(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	devices, err := models.GetDevicesByUserID(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed_to_fetch", "message": err.Error()})
+		return
+	}
+
+	// 标记发起请求的设备
+	currentID := middlewares.GetCurrentDeviceID(c)
+	result := make([]gin.H, 0, len(devices))
+	for _, device := range devices {
+		result = append(result, gin.H{
+			"id":           device.ID,
+			"name":         device.Name,
+			"user_agent":   device.UserAgent,
+			"last_ip":      device.LastIP,
+			"last_seen_at": device.LastSeenAt,
+			"created_at":   device.CreatedAt,
+			"current":      device.ID == currentID,
+		})
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// UpdateDevice 修改设备名称
+func UpdateDevice(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	var req UpdateDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	device, err := models.RenameDevice(c.Param("id"), user.ID, req.Name)
+	if err != nil {
+		if err.Error() == "device not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": "Device not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "update_failed", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, device)
+}
+
+// DeleteDevice 删除设备并撤销其全部凭据
+func DeleteDevice(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	if err := models.DeleteDevice(c.Param("id"), user.ID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Device deleted successfully"})
+}
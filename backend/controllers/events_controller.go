@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/weicopy/backend/events"
+	"github.com/weicopy/backend/middlewares"
+)
+
+// SSE心跳间隔，防止代理断开空闲连接
+const sseHeartbeatInterval = 25 * time.Second
+
+// 长连接重新校验凭据的间隔，会话或令牌被撤销、账户被停用后最迟在此时间内断开
+const streamCredentialCheckInterval = 5 * time.Second
+
+// StreamClipboardEvents 通过Server-Sent Events推送剪贴板变更
+func StreamClipboardEvents(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	// 支持通过Last-Event-ID头部或查询参数断线续传
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	var lastID uint64
+	if lastEventID != "" {
+		lastID, err = strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": "Invalid Last-Event-ID"})
+			return
+		}
+	}
+
+	// 先订阅再补发，避免遗漏补发期间产生的事件
+	sub := events.Subscribe(user.ID)
+	defer sub.Close()
+
+	var backlog []events.Event
+	complete := true
+	if lastID > 0 {
+		backlog, complete, err = events.Replay(user.ID, lastID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed_to_fetch", "message": err.Error()})
+			return
+		}
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// 关闭nginx的响应缓冲
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	// 无法补发完整历史时通知客户端重新拉取列表
+	replayed := lastID
+	if !complete {
+		fmt.Fprint(c.Writer, "event: reset\ndata: {}\n\n")
+		replayed = 0
+	}
+	for _, event := range backlog {
+		if err := writeSSEEvent(c, event); err != nil {
+			return
+		}
+		replayed = event.ID
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	checkCredential := middlewares.CredentialChecker(c)
+	credentialCheck := time.NewTicker(streamCredentialCheckInterval)
+	defer credentialCheck.Stop()
+
+	ctx := c.Request.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-sub.C:
+			if !ok {
+				// 订阅被广播器关闭，客户端会自动重连
+				return
+			}
+			// 跳过已经补发过的事件
+			if event.ID <= replayed {
+				continue
+			}
+			if err := writeSSEEvent(c, event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+		case <-credentialCheck.C:
+			// 凭据已失效时结束事件流，客户端重连时会收到401
+			if checkCredential() != nil {
+				return
+			}
+			continue
+		}
+		c.Writer.Flush()
+	}
+}
+
+// 写出一条SSE事件
+func writeSSEEvent(c *gin.Context, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
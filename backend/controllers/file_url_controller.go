@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/weicopy/backend/config"
+	"github.com/weicopy/backend/middlewares"
+	"github.com/weicopy/backend/models"
+	"github.com/weicopy/backend/signedurl"
+)
+
+var (
+	fileURLSigner     *signedurl.Signer
+	fileURLSignerOnce sync.Once
+)
+
+// 获取下载链接的签名器，密钥由JWT密钥派生
+func getFileURLSigner() *signedurl.Signer {
+	fileURLSignerOnce.Do(func() {
+		fileURLSigner = signedurl.New(config.GetJWTSecret(), "file")
+	})
+	return fileURLSigner
+}
+
+// 签名绑定项目ID和所属用户
+func fileURLResource(item *models.ClipboardItem) string {
+	return "file:" + item.ID + ":" + strconv.FormatUint(uint64(item.UserID), 10)
+}
+
+// GetFileURL 为文件或图片生成有时效的签名下载链接，可直接用于img标签或wget
+func GetFileURL(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	item, err := models.GetClipboardItemByID(c.Param("id"))
+	if err != nil || item.UserID != user.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": "Item not found"})
+		return
+	}
+
+	if item.Type != models.TypeFile && item.Type != models.TypeImage {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_item_type", "message": "Item is not a file or image"})
+		return
+	}
+
+	expiresAt := time.Now().Add(config.GetDownloadURLTTL())
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Set("signature", getFileURLSigner().Sign(fileURLResource(item), expiresAt))
+
+	c.JSON(http.StatusOK, gin.H{
+		"url":        absoluteURL(c, "/api/files/"+url.PathEscape(item.ID)+"?"+query.Encode()),
+		"expires_at": time.Unix(expiresAt.Unix(), 0),
+	})
+}
+
+// DownloadSignedFile 凭签名下载链接获取文件，无需认证头
+func DownloadSignedFile(c *gin.Context) {
+	item, err := models.GetClipboardItemByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": "Item not found"})
+		return
+	}
+
+	err = getFileURLSigner().Verify(fileURLResource(item), c.Query("expires"), c.Query("signature"), time.Now())
+	if err != nil {
+		if errors.Is(err, signedurl.ErrExpired) {
+			c.JSON(http.StatusGone, gin.H{"error": "link_expired", "message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "invalid_signature", "message": err.Error()})
+		return
+	}
+
+	// 用户被停用后已签发的链接同样失效
+	owner, err := models.FindUserByID(item.UserID)
+	if err != nil || owner.IsDisabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": "Item not found"})
+		return
+	}
+
+	// 不允许代理等共享缓存保存内容
+	c.Header("Cache-Control", "private")
+	serveItemFile(c, item)
+}
+
+// 根据请求的协议和主机生成绝对地址
+func absoluteURL(c *gin.Context, path string) string {
+	scheme := "http"
+	if isSecureRequest(c) {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, c.Request.Host, path)
+}
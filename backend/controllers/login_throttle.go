@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/weicopy/backend/config"
+	"github.com/weicopy/backend/models"
+)
+
+// 检查用户名和客户端IP是否处于登录锁定期，锁定时返回429并设置Retry-After
+func checkLoginThrottle(c *gin.Context, username string) bool {
+	var wait time.Duration
+	for kind, identifier := range loginThrottleKeys(c, username) {
+		remaining, err := models.LoginLockoutRemaining(kind, identifier)
+		if err != nil {
+			log.Printf("auth: failed to check login lockout: %v", err)
+			continue
+		}
+		if remaining > wait {
+			wait = remaining
+		}
+	}
+
+	if wait <= 0 {
+		return true
+	}
+
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "too_many_attempts",
+		"message":     "Too many failed login attempts, please try again later",
+		"retry_after": seconds,
+	})
+	return false
+}
+
+// 记录一次登录失败，用户名和IP分别计数
+func recordLoginFailure(c *gin.Context, username string) {
+	maxLockout := config.GetLoginLockoutDuration()
+	limits := map[string]int{
+		models.LoginAttemptUsername: config.GetLoginMaxAttempts(),
+		models.LoginAttemptIP:       config.GetLoginMaxAttemptsPerIP(),
+	}
+	for kind, identifier := range loginThrottleKeys(c, username) {
+		if err := models.RecordLoginFailure(kind, identifier, limits[kind], maxLockout); err != nil {
+			log.Printf("auth: failed to record login failure: %v", err)
+		}
+	}
+}
+
+// 登录成功后清除该用户名的失败计数，IP计数按时间自然衰减
+func clearLoginFailures(username string) {
+	if err := models.ClearLoginFailures(models.LoginAttemptUsername, username); err != nil {
+		log.Printf("auth: failed to clear login failures: %v", err)
+	}
+}
+
+// 计数使用的用户名和IP，ClientIP只采信TRUSTED_PROXIES中代理转发的地址，客户端无法伪造
+func loginThrottleKeys(c *gin.Context, username string) map[string]string {
+	keys := map[string]string{models.LoginAttemptIP: c.ClientIP()}
+	if username != "" {
+		keys[models.LoginAttemptUsername] = username
+	}
+	return keys
+}
@@ -0,0 +1,339 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/weicopy/backend/config"
+	"github.com/weicopy/backend/middlewares"
+	"github.com/weicopy/backend/models"
+	"github.com/weicopy/backend/oidc"
+)
+
+// 单点登录状态Cookie的名称、受众和有效期
+const (
+	oidcStateCookie   = "weicopy_oidc"
+	oidcStateAudience = "weicopy:oidc"
+	oidcStateTTL      = 10 * time.Minute
+	// 重新认证时要求用户在此时间内于身份提供方完成过登录
+	oidcReauthMaxAge = 5 * time.Minute
+)
+
+var (
+	oidcProvider     *oidc.Provider
+	oidcProviderOnce sync.Once
+)
+
+// 授权请求的状态，签名后保存在Cookie中，回调时用于校验state、nonce和PKCE
+type oidcStateClaims struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	// 非零时表示将外部身份关联到该用户，而不是登录
+	LinkUserID uint `json:"link_user_id,omitempty"`
+	// 非零时表示该用户为敏感操作重新认证，回调时签发重新认证令牌而不是登录
+	ReauthUserID uint `json:"reauth_user_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// GetOIDCConfig 返回单点登录是否可用，供前端决定是否显示单点登录按钮
+func GetOIDCConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"enabled": getOIDCProvider() != nil})
+}
+
+// OIDCLogin 跳转到身份提供方进行登录
+func OIDCLogin(c *gin.Context) {
+	provider := getOIDCProvider()
+	if provider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "oidc_disabled", "message": "Single sign-on is not configured"})
+		return
+	}
+
+	authURL, err := startOIDCFlow(c, provider, 0, 0)
+	if err != nil {
+		log.Printf("oidc: failed to start login: %v", err)
+		redirectToFrontend(c, url.Values{"error": {"oidc_unavailable"}})
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// LinkOIDCIdentity 为已登录用户生成关联外部身份的授权地址，前端随后跳转到该地址
+func LinkOIDCIdentity(c *gin.Context) {
+	provider := getOIDCProvider()
+	if provider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "oidc_disabled", "message": "Single sign-on is not configured"})
+		return
+	}
+
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	authURL, err := startOIDCFlow(c, provider, user.ID, 0)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "oidc_unavailable", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+}
+
+// ReauthenticateOIDC 为只能通过单点登录的用户生成重新认证的授权地址，要求在身份提供方重新输入凭据
+// 回调后前端获得重新认证令牌，注销账户等敏感操作时代替密码提交
+func ReauthenticateOIDC(c *gin.Context) {
+	provider := getOIDCProvider()
+	if provider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "oidc_disabled", "message": "Single sign-on is not configured"})
+		return
+	}
+
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	authURL, err := startOIDCFlow(c, provider, 0, user.ID)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "oidc_unavailable", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"authorization_url": authURL})
+}
+
+// OIDCCallback 处理身份提供方的回调，校验ID令牌后登录或关联账户
+// 结果通过URL片段传回前端，避免令牌出现在服务器和代理日志中
+func OIDCCallback(c *gin.Context) {
+	provider := getOIDCProvider()
+	if provider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "oidc_disabled", "message": "Single sign-on is not configured"})
+		return
+	}
+
+	cookie, _ := c.Cookie(oidcStateCookie)
+	clearOIDCStateCookie(c)
+
+	if errCode := c.Query("error"); errCode != "" {
+		redirectToFrontend(c, url.Values{"error": {errCode}})
+		return
+	}
+
+	state, err := parseOIDCState(cookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(state.State), []byte(c.Query("state"))) != 1 {
+		redirectToFrontend(c, url.Values{"error": {"invalid_state"}})
+		return
+	}
+
+	claims, err := provider.Exchange(c.Request.Context(), c.Query("code"), state.Verifier, state.Nonce)
+	if err != nil {
+		log.Printf("oidc: code exchange failed: %v", err)
+		redirectToFrontend(c, url.Values{"error": {"invalid_id_token"}})
+		return
+	}
+
+	issuer, err := provider.Issuer(c.Request.Context())
+	if err != nil {
+		redirectToFrontend(c, url.Values{"error": {"oidc_unavailable"}})
+		return
+	}
+
+	if state.LinkUserID != 0 {
+		if err := models.LinkIdentity(state.LinkUserID, issuer, claims.Subject); err != nil {
+			redirectToFrontend(c, url.Values{"error": {"identity_conflict"}})
+			return
+		}
+		redirectToFrontend(c, url.Values{"linked": {"true"}})
+		return
+	}
+
+	if state.ReauthUserID != 0 {
+		redirectToFrontend(c, oidcReauthResult(state.ReauthUserID, issuer, claims))
+		return
+	}
+
+	user, err := models.FindUserByIdentity(issuer, claims.Subject)
+	if err != nil {
+		if !config.IsOIDCAutoProvisionEnabled() {
+			redirectToFrontend(c, url.Values{"error": {"account_not_linked"}})
+			return
+		}
+
+		user, err = models.ProvisionIdentityUser(issuer, claims.Subject, claims.Claim(config.GetOIDCUsernameClaim()))
+		if err != nil {
+			log.Printf("oidc: failed to provision user: %v", err)
+			redirectToFrontend(c, url.Values{"error": {"provisioning_failed"}})
+			return
+		}
+	}
+
+	if user.IsDisabled() {
+		redirectToFrontend(c, url.Values{"error": {"account_disabled"}})
+		return
+	}
+
+	// 本地启用了两步验证的账户仍需完成第二步
+	if user.TOTPEnabled {
+		challenge, err := generateTwoFactorChallenge(user.ID, "")
+		if err != nil {
+			redirectToFrontend(c, url.Values{"error": {"token_generation_failed"}})
+			return
+		}
+		redirectToFrontend(c, url.Values{
+			"two_factor_required": {"true"},
+			"challenge_token":     {challenge},
+		})
+		return
+	}
+
+	tokens, err := issueTokens(c, user, "")
+	if err != nil {
+		redirectToFrontend(c, url.Values{"error": {"token_generation_failed"}})
+		return
+	}
+
+	values := url.Values{}
+	for _, key := range []string{"token", "refresh_token", "expires_in", "device_id"} {
+		values.Set(key, toString(tokens[key]))
+	}
+	redirectToFrontend(c, values)
+}
+
+// 校验重新认证的外部身份属于发起的用户且刚刚完成登录，返回传给前端的结果
+func oidcReauthResult(userID uint, issuer string, claims *oidc.IDTokenClaims) url.Values {
+	user, err := models.FindUserByIdentity(issuer, claims.Subject)
+	if err != nil || user.ID != userID {
+		return url.Values{"error": {"identity_mismatch"}}
+	}
+	// 身份提供方可能忽略prompt=login而直接使用已有的登录状态
+	if claims.AuthTime == nil || time.Since(claims.AuthTime.Time) > oidcReauthMaxAge {
+		return url.Values{"error": {"reauthentication_required"}}
+	}
+
+	token, err := generateReauthToken(user.ID)
+	if err != nil {
+		return url.Values{"error": {"token_generation_failed"}}
+	}
+	return url.Values{"reauth_token": {token}}
+}
+
+// 根据配置创建身份提供方客户端，未配置时返回nil
+func getOIDCProvider() *oidc.Provider {
+	oidcProviderOnce.Do(func() {
+		if config.GetOIDCIssuer() == "" || config.GetOIDCClientID() == "" || config.GetOIDCRedirectURL() == "" {
+			return
+		}
+		oidcProvider = oidc.NewProvider(oidc.Config{
+			Issuer:       config.GetOIDCIssuer(),
+			ClientID:     config.GetOIDCClientID(),
+			ClientSecret: config.GetOIDCClientSecret(),
+			RedirectURL:  config.GetOIDCRedirectURL(),
+			Scopes:       config.GetOIDCScopes(),
+		})
+	})
+	return oidcProvider
+}
+
+// 生成state、nonce和PKCE校验值，写入签名Cookie并返回授权地址
+func startOIDCFlow(c *gin.Context, provider *oidc.Provider, linkUserID, reauthUserID uint) (string, error) {
+	var values [3]string
+	for i := range values {
+		value, err := oidc.GenerateVerifier()
+		if err != nil {
+			return "", err
+		}
+		values[i] = value
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), state, nonce, verifier)
+	if err != nil {
+		return "", err
+	}
+	// 重新认证时要求身份提供方重新登录，并在ID令牌中返回认证时间
+	if reauthUserID != 0 {
+		authURL += "&" + url.Values{"prompt": {"login"}, "max_age": {"0"}}.Encode()
+	}
+
+	now := time.Now()
+	claims := &oidcStateClaims{
+		State:        state,
+		Nonce:        nonce,
+		Verifier:     verifier,
+		LinkUserID:   linkUserID,
+		ReauthUserID: reauthUserID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{oidcStateAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(oidcStateTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(config.GetJWTSecret()))
+	if err != nil {
+		return "", err
+	}
+
+	// 回调是身份提供方发起的顶级跳转，需要SameSite=Lax才能携带Cookie
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, signed, int(oidcStateTTL.Seconds()), "/api/auth/oidc", "", isSecureRequest(c), true)
+
+	return authURL, nil
+}
+
+// 解析并校验状态Cookie
+func parseOIDCState(cookie string) (*oidcStateClaims, error) {
+	if cookie == "" {
+		return nil, errors.New("missing state cookie")
+	}
+
+	claims := &oidcStateClaims{}
+	token, err := jwt.ParseWithClaims(cookie, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(config.GetJWTSecret()), nil
+	})
+	if err != nil || !token.Valid || !claims.VerifyAudience(oidcStateAudience, true) {
+		return nil, errors.New("invalid state cookie")
+	}
+
+	return claims, nil
+}
+
+func clearOIDCStateCookie(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, "", -1, "/api/auth/oidc", "", isSecureRequest(c), true)
+}
+
+// 判断客户端是否通过HTTPS访问，兼容前端nginx反向代理
+func isSecureRequest(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
+
+// 携带URL片段跳转回前端
+func redirectToFrontend(c *gin.Context, values url.Values) {
+	c.Redirect(http.StatusFound, config.GetOIDCFrontendURL()+"#"+values.Encode())
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
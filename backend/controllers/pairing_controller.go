@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/weicopy/backend/middlewares"
+	"github.com/weicopy/backend/models"
+)
+
+// 配对码有效期
+const pairingCodeTTL = 5 * time.Minute
+
+// 创建配对码的请求结构
+type CreatePairingCodeRequest struct {
+	// 新设备令牌的权限范围，为空时使用默认的剪贴板读写删除权限
+	Scopes []string `json:"scopes"`
+}
+
+// 兑换配对码的请求结构
+type PairDeviceRequest struct {
+	Code       string `json:"code" binding:"required"`
+	DeviceName string `json:"device_name" binding:"max=100"`
+}
+
+// CreatePairingCode 已登录设备生成短期有效的一次性配对码
+func CreatePairingCode(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	var req CreatePairingCodeRequest
+	// 请求体可为空
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+			return
+		}
+	}
+
+	scopes := models.DefaultTokenScopes
+	if len(req.Scopes) > 0 {
+		scopes, err = models.ParseScopes(req.Scopes)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_scope", "message": err.Error()})
+			return
+		}
+	}
+
+	// 新设备的权限不能超过当前令牌
+	if !middlewares.GetCurrentScopes(c).Contains(scopes) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient_scope", "message": "Cannot grant scopes beyond those of the current token"})
+		return
+	}
+
+	pairing, code, err := models.CreatePairingCode(user.ID, scopes, pairingCodeTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "creation_failed", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		// 以连字符分成两段便于输入，兑换时会忽略连字符
+		"code":       code[:models.PairingCodeLength/2] + "-" + code[models.PairingCodeLength/2:],
+		"scopes":     pairing.Scopes,
+		"expires_at": pairing.ExpiresAt,
+	})
+}
+
+// PairDevice 新设备使用配对码换取绑定该设备的个人访问令牌，无需认证
+func PairDevice(c *gin.Context) {
+	var req PairDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	device, token, err := models.RedeemPairingCode(req.Code, req.DeviceName, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		if err.Error() == "invalid or expired pairing code" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_pairing_code", "message": "Invalid or expired pairing code"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "pairing_failed", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":  token,
+		"device": device,
+	})
+}
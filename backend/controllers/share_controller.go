@@ -0,0 +1,255 @@
+package controllers
+
+import (
+	"errors"
+	"html/template"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/weicopy/backend/middlewares"
+	"github.com/weicopy/backend/models"
+	"github.com/weicopy/backend/storage"
+)
+
+// 创建分享链接的请求结构
+type CreateShareRequest struct {
+	ItemID string `json:"item_id" binding:"required"`
+	// 有效小时数，为空或0表示永不过期
+	ExpiresInHours int `json:"expires_in_hours" binding:"min=0"`
+	// 最大查看次数，为空或0表示不限次数
+	MaxViews int `json:"max_views" binding:"min=0"`
+	// 访问密码，为空表示无需密码
+	Password string `json:"password" binding:"max=72"`
+}
+
+// 可以在浏览器中直接显示的图片类型，按扩展名确定响应的Content-Type
+var inlineImageTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// 需要密码时展示给浏览器的页面
+var sharePasswordPage = template.Must(template.New("share").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>WeiCopy</title></head>
+<body style="font-family: sans-serif; max-width: 360px; margin: 80px auto;">
+<form method="post">
+<p>{{if .Invalid}}Incorrect password, please try again.{{else}}This shared item is password protected.{{end}}</p>
+<input type="password" name="password" autofocus required style="width: 100%; padding: 8px; box-sizing: border-box;">
+<button type="submit" style="margin-top: 12px; padding: 8px 16px;">View</button>
+</form>
+</body>
+</html>`))
+
+// GetShares 获取当前用户创建的分享链接
+func GetShares(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	shares, err := models.GetSharesByUserID(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed_to_fetch", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, shares)
+}
+
+// CreateShare 为剪贴板项目创建公开分享链接，链接仅在创建时返回一次
+func CreateShare(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	var req CreateShareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	item, err := models.GetClipboardItemByID(req.ItemID)
+	if err != nil || item.UserID != user.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": "Item not found"})
+		return
+	}
+
+	// 阅后即焚项目的读取次数只属于所有者
+	if item.IsBurnAfterRead() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_item_type", "message": "Burn-after-read items cannot be shared"})
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInHours > 0 {
+		t := time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour)
+		expiresAt = &t
+	}
+
+	share, token, err := models.CreateShare(user.ID, item.ID, req.Password, req.MaxViews, expiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "creation_failed", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"url": absoluteURL(c, "/s/"+token), "details": share})
+}
+
+// RevokeShare 撤销分享链接
+func RevokeShare(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": "Invalid share ID"})
+		return
+	}
+
+	if err := models.RevokeShare(uint(id), user.ID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Share revoked successfully"})
+}
+
+// ViewShare 无需登录访问分享的项目：文本直接返回内容，文件和图片返回文件
+// 设置了密码时通过表单字段password或请求头X-Share-Password提供
+func ViewShare(c *gin.Context) {
+	// 分享内容由用户上传，禁止浏览器嗅探内容类型，并在沙箱中处理，避免HTML等内容在本站源下执行脚本
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "sandbox")
+
+	share, err := models.FindShareByToken(c.Param("token"))
+	if err != nil {
+		shareNotFound(c, err)
+		return
+	}
+
+	if share.HasPassword {
+		// 与登录共用按IP的失败计数，防止穷举密码
+		if !checkLoginThrottle(c, "") {
+			return
+		}
+
+		password := c.GetHeader("X-Share-Password")
+		if password == "" && c.Request.Method == http.MethodPost {
+			password = c.PostForm("password")
+		}
+
+		if password == "" || !share.CheckPassword(password) {
+			if password != "" {
+				recordLoginFailure(c, "")
+			}
+			sharePasswordRequired(c, password != "")
+			return
+		}
+	}
+
+	item, err := models.GetClipboardItemByID(share.ItemID)
+	if err != nil {
+		shareNotFound(c, models.ErrShareUnavailable)
+		return
+	}
+
+	owner, err := models.FindUserByID(item.UserID)
+	if err != nil || owner.IsDisabled() {
+		shareNotFound(c, models.ErrShareUnavailable)
+		return
+	}
+
+	var file *storage.Object
+	if item.FilePath != "" {
+		file, err = storage.Open(c.Request.Context(), storage.Default, item.FilePath)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotExist) {
+				err = models.ErrShareUnavailable
+			}
+			shareNotFound(c, err)
+			return
+		}
+		defer file.Close()
+	}
+
+	if err := models.ConsumeShareView(share.ID); err != nil {
+		shareNotFound(c, err)
+		return
+	}
+
+	// 分享内容不应被搜索引擎收录或被共享缓存保存
+	c.Header("X-Robots-Tag", "noindex")
+	c.Header("Cache-Control", "private, no-store")
+
+	if item.Type == models.TypeText {
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(item.Content))
+		return
+	}
+
+	setFileContentHeaders(c, item)
+	http.ServeContent(c.Writer, c.Request, path.Base(item.FilePath), file.ModTime(), file)
+}
+
+// 白名单中的图片类型直接显示，其他文件一律以原文件名作为附件下载
+// Content-Type由服务端决定，不使用上传时的类型或内容嗅探的结果
+func setFileContentHeaders(c *gin.Context, item *models.ClipboardItem) {
+	if item.Type == models.TypeImage {
+		if contentType, ok := inlineImageTypes[strings.ToLower(path.Ext(item.FilePath))]; ok {
+			c.Header("Content-Type", contentType)
+			return
+		}
+	}
+
+	c.Header("Content-Type", "application/octet-stream")
+	setAttachmentHeader(c, item.Filename)
+}
+
+// 设置下载文件名，引号等特殊字符会被转义，非ASCII文件名按RFC 2231编码
+func setAttachmentHeader(c *gin.Context, filename string) {
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	c.Header("Content-Disposition", disposition)
+}
+
+func shareNotFound(c *gin.Context, err error) {
+	if errors.Is(err, models.ErrShareUnavailable) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "failed_to_fetch", "message": err.Error()})
+}
+
+// 浏览器访问时返回密码表单，其他客户端返回JSON错误
+func sharePasswordRequired(c *gin.Context, invalid bool) {
+	if strings.Contains(c.GetHeader("Accept"), "text/html") {
+		// 沙箱默认禁止提交表单，密码页面需要放开
+		c.Header("Content-Security-Policy", "sandbox allow-forms")
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.Status(http.StatusUnauthorized)
+		sharePasswordPage.Execute(c.Writer, gin.H{"Invalid": invalid})
+		return
+	}
+
+	if invalid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_password", "message": "Incorrect share password"})
+		return
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "password_required", "message": "This share is password protected"})
+}
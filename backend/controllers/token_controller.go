@@ -0,0 +1,123 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/weicopy/backend/middlewares"
+	"github.com/weicopy/backend/models"
+)
+
+// 创建个人访问令牌的请求结构
+type CreateTokenRequest struct {
+	Name string `json:"name" binding:"required,min=1,max=100"`
+	// 权限范围，为空时使用默认的剪贴板读写删除权限
+	Scopes []string `json:"scopes"`
+	// 绑定的已有设备ID，为空时以令牌名称登记新设备
+	DeviceID string `json:"device_id"`
+	// 有效天数，为空或0表示永不过期
+	ExpiresInDays int `json:"expires_in_days" binding:"min=0"`
+}
+
+// GetAPITokens 获取当前用户的个人访问令牌列表
+func GetAPITokens(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	tokens, err := models.GetAPITokensByUserID(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed_to_fetch", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// CreateAPIToken 创建个人访问令牌，明文令牌仅在创建时返回一次
+func CreateAPIToken(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	var req CreateTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	scopes := models.DefaultTokenScopes
+	if len(req.Scopes) > 0 {
+		scopes, err = models.ParseScopes(req.Scopes)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_scope", "message": err.Error()})
+			return
+		}
+	}
+
+	// 不能创建权限超过当前令牌的新令牌
+	if !middlewares.GetCurrentScopes(c).Contains(scopes) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient_scope", "message": "Cannot grant scopes beyond those of the current token"})
+		return
+	}
+
+	deviceID := req.DeviceID
+	if deviceID != "" {
+		if _, err := models.FindDeviceByID(deviceID, user.ID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": "Device not found"})
+			return
+		}
+	} else {
+		device, err := models.CreateDevice(user.ID, req.Name, "", c.ClientIP())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "creation_failed", "message": err.Error()})
+			return
+		}
+		deviceID = device.ID
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	token, plaintext, err := models.CreateAPIToken(user.ID, deviceID, req.Name, scopes, expiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "creation_failed", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":   plaintext,
+		"details": token,
+	})
+}
+
+// DeleteAPIToken 撤销个人访问令牌
+func DeleteAPIToken(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": "Invalid token ID"})
+		return
+	}
+
+	if err := models.DeleteAPIToken(uint(id), user.ID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked successfully"})
+}
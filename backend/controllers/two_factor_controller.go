@@ -0,0 +1,290 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/weicopy/backend/config"
+	"github.com/weicopy/backend/middlewares"
+	"github.com/weicopy/backend/models"
+	"github.com/weicopy/backend/totp"
+)
+
+// 两步验证挑战令牌的受众和有效期
+const (
+	twoFactorAudience     = "weicopy:2fa"
+	twoFactorChallengeTTL = 5 * time.Minute
+)
+
+// 两步验证挑战令牌的声明结构，密码验证通过后签发，仅能用于完成登录第二步
+type twoFactorClaims struct {
+	UserID     uint   `json:"user_id"`
+	DeviceName string `json:"device_name,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// 提交验证码的请求结构，code和recovery_code二选一
+type TwoFactorCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// 登录第二步的请求结构
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	TwoFactorCodeRequest
+}
+
+// 关闭两步验证的请求结构
+type DisableTwoFactorRequest struct {
+	ReauthRequest
+	TwoFactorCodeRequest
+}
+
+// SetupTwoFactor 生成待确认的TOTP密钥和供验证器应用扫描的地址
+func SetupTwoFactor(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "already_enabled", "message": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "setup_failed", "message": err.Error()})
+		return
+	}
+
+	if err := models.SetPendingTOTPSecret(user.ID, secret); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "setup_failed", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           secret,
+		"provisioning_uri": totp.ProvisioningURI(config.GetTOTPIssuer(), user.Username, secret),
+	})
+}
+
+// EnableTwoFactor 提交验证器应用生成的验证码以确认并启用两步验证，返回恢复码
+func EnableTwoFactor(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": "Verification code is required"})
+		return
+	}
+
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "already_enabled", "message": "Two-factor authentication is already enabled"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "setup_required", "message": "Call the setup endpoint first"})
+		return
+	}
+
+	step, ok := totp.Validate(user.TOTPSecret, req.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_code", "message": "Invalid verification code"})
+		return
+	}
+
+	codes, err := models.EnableTOTP(user.ID, step)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "enable_failed", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor 关闭两步验证，需要同时重新认证并提供验证码（或恢复码）
+func DisableTwoFactor(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "not_enabled", "message": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	if !reauthenticate(c, user, req.ReauthRequest, "Invalid password") {
+		return
+	}
+
+	if err := verifySecondFactor(user, req.TwoFactorCodeRequest); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_code", "message": err.Error()})
+		return
+	}
+
+	if err := models.DisableTOTP(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "disable_failed", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes 使用验证码重新生成恢复码，旧恢复码全部失效
+func RegenerateRecoveryCodes(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": "Verification code is required"})
+		return
+	}
+
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "not_enabled", "message": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	if err := verifySecondFactor(user, TwoFactorCodeRequest{Code: req.Code}); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_code", "message": err.Error()})
+		return
+	}
+
+	codes, err := models.RegenerateRecoveryCodes(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "regenerate_failed", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// LoginTwoFactor 登录第二步：校验挑战令牌和验证码后签发正常的访问令牌
+func LoginTwoFactor(c *gin.Context) {
+	var req TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	claims, err := parseTwoFactorChallenge(req.ChallengeToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_challenge", "message": "Invalid or expired challenge token"})
+		return
+	}
+
+	user, err := models.FindUserByID(claims.UserID)
+	if err != nil || !user.TOTPEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_challenge", "message": "Invalid or expired challenge token"})
+		return
+	}
+
+	// 验证码同样计入登录失败次数，防止在挑战令牌有效期内穷举
+	if !checkLoginThrottle(c, user.Username) {
+		return
+	}
+
+	if err := verifySecondFactor(user, req.TwoFactorCodeRequest); err != nil {
+		recordLoginFailure(c, user.Username)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_code", "message": err.Error()})
+		return
+	}
+
+	clearLoginFailures(user.Username)
+
+	if !checkUserEnabled(c, user) {
+		return
+	}
+
+	tokens, err := issueTokens(c, user, claims.DeviceName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token_generation_failed", "message": "Failed to generate token"})
+		return
+	}
+
+	tokens["user"] = gin.H{
+		"id":       user.ID,
+		"username": user.Username,
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// 校验TOTP验证码或恢复码
+func verifySecondFactor(user *models.User, req TwoFactorCodeRequest) error {
+	if req.RecoveryCode != "" {
+		return models.ConsumeRecoveryCode(user.ID, req.RecoveryCode)
+	}
+
+	if req.Code == "" {
+		return errors.New("verification code or recovery code is required")
+	}
+
+	step, ok := totp.Validate(user.TOTPSecret, req.Code, time.Now())
+	if !ok {
+		return errors.New("invalid verification code")
+	}
+
+	return models.ConsumeTOTPStep(user.ID, step)
+}
+
+// 生成两步验证挑战令牌
+func generateTwoFactorChallenge(userID uint, deviceName string) (string, error) {
+	now := time.Now()
+	claims := &twoFactorClaims{
+		UserID:     userID,
+		DeviceName: deviceName,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{twoFactorAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(twoFactorChallengeTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(config.GetJWTSecret()))
+}
+
+// 解析并校验两步验证挑战令牌
+func parseTwoFactorChallenge(tokenString string) (*twoFactorClaims, error) {
+	claims := &twoFactorClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(config.GetJWTSecret()), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid challenge token")
+	}
+
+	if !claims.VerifyAudience(twoFactorAudience, true) {
+		return nil, errors.New("invalid challenge token")
+	}
+
+	return claims, nil
+}
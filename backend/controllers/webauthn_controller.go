@@ -0,0 +1,391 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/weicopy/backend/config"
+	"github.com/weicopy/backend/middlewares"
+	"github.com/weicopy/backend/models"
+	"github.com/weicopy/backend/webauthn"
+)
+
+// WebAuthn挑战的有效期，略长于浏览器等待用户操作的时间
+const webAuthnChallengeTTL = 3 * time.Minute
+
+// 浏览器返回的公钥凭据，二进制字段均为base64url编码
+type PublicKeyCredential struct {
+	ID       string `json:"id" binding:"required"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON" binding:"required"`
+		AttestationObject string `json:"attestationObject"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response" binding:"required"`
+}
+
+// 注册通行密钥的请求结构
+type WebAuthnRegisterRequest struct {
+	Name       string              `json:"name" binding:"max=100"`
+	Credential PublicKeyCredential `json:"credential" binding:"required"`
+}
+
+// 获取登录选项的请求结构，提供用户名时只允许该用户的凭据
+type WebAuthnLoginOptionsRequest struct {
+	Username string `json:"username"`
+}
+
+// 通行密钥登录的请求结构
+type WebAuthnLoginRequest struct {
+	DeviceName string              `json:"device_name" binding:"max=100"`
+	Credential PublicKeyCredential `json:"credential" binding:"required"`
+}
+
+// WebAuthnRegisterOptions 为当前用户生成注册通行密钥的选项
+func WebAuthnRegisterOptions(c *gin.Context) {
+	rp, ok := webAuthnConfig(c)
+	if !ok {
+		return
+	}
+
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	credentials, err := models.GetWebAuthnCredentialsByUserID(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed_to_fetch", "message": err.Error()})
+		return
+	}
+	exclude := make([][]byte, 0, len(credentials))
+	for _, credential := range credentials {
+		exclude = append(exclude, credential.CredentialID)
+	}
+
+	challenge, err := newWebAuthnChallenge(user.ID, models.WebAuthnRegistration)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "challenge_failed", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"publicKey": rp.NewCreationOptions(challenge, webAuthnUserHandle(user.ID), user.Username, exclude),
+	})
+}
+
+// WebAuthnRegister 校验认证器返回的注册结果并保存通行密钥
+func WebAuthnRegister(c *gin.Context) {
+	rp, ok := webAuthnConfig(c)
+	if !ok {
+		return
+	}
+
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	var req WebAuthnRegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	clientDataJSON, err1 := decodeBase64URL(req.Credential.Response.ClientDataJSON)
+	attestationObject, err2 := decodeBase64URL(req.Credential.Response.AttestationObject)
+	if err1 != nil || err2 != nil || len(attestationObject) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": "Invalid credential encoding"})
+		return
+	}
+
+	challenge, ok := consumeWebAuthnChallenge(c, models.WebAuthnRegistration, clientDataJSON)
+	if !ok {
+		return
+	}
+	if challenge.record.UserID != user.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_challenge", "message": "Invalid or expired challenge"})
+		return
+	}
+
+	credential, err := rp.VerifyRegistration(challenge.value, clientDataJSON, attestationObject, false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_credential", "message": err.Error()})
+		return
+	}
+
+	if _, err := models.FindWebAuthnCredential(credential.ID); err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "credential_exists", "message": "This passkey is already registered"})
+		return
+	}
+
+	name := req.Name
+	if name == "" {
+		name = "Passkey"
+	}
+	saved, err := models.CreateWebAuthnCredential(user.ID, name, credential.ID, credential.PublicKey, credential.SignCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "creation_failed", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, saved)
+}
+
+// WebAuthnLoginOptions 生成通行密钥登录的选项，无需认证
+func WebAuthnLoginOptions(c *gin.Context) {
+	rp, ok := webAuthnConfig(c)
+	if !ok {
+		return
+	}
+
+	var req WebAuthnLoginOptionsRequest
+	// 请求体可为空
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+			return
+		}
+	}
+
+	// 未提供用户名或用户不存在时不限制凭据，由认证器列出可发现凭据，避免泄露用户是否存在
+	var allow [][]byte
+	var userID uint
+	requireUserVerification := false
+	if req.Username != "" {
+		if user, err := models.FindUserByUsername(req.Username); err == nil {
+			credentials, err := models.GetWebAuthnCredentialsByUserID(user.ID)
+			if err == nil && len(credentials) > 0 {
+				userID = user.ID
+				// 启用了两步验证的用户只有经过用户验证的通行密钥才能代替TOTP
+				requireUserVerification = user.TOTPEnabled
+				for _, credential := range credentials {
+					allow = append(allow, credential.CredentialID)
+				}
+			}
+		}
+	}
+
+	challenge, err := newWebAuthnChallenge(userID, models.WebAuthnLogin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "challenge_failed", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"publicKey": rp.NewRequestOptions(challenge, allow, requireUserVerification)})
+}
+
+// WebAuthnLogin 校验通行密钥断言，成功后签发与密码登录相同的令牌
+// 认证器验证了用户（PIN或生物识别）时通行密钥同时提供持有和验证两个因素，不再要求TOTP；
+// 启用了两步验证的用户使用未经用户验证的断言登录时，与密码登录一样继续要求验证码
+func WebAuthnLogin(c *gin.Context) {
+	rp, ok := webAuthnConfig(c)
+	if !ok {
+		return
+	}
+
+	var req WebAuthnLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return
+	}
+
+	credentialID, err1 := decodeBase64URL(req.Credential.ID)
+	clientDataJSON, err2 := decodeBase64URL(req.Credential.Response.ClientDataJSON)
+	authenticatorData, err3 := decodeBase64URL(req.Credential.Response.AuthenticatorData)
+	signature, err4 := decodeBase64URL(req.Credential.Response.Signature)
+	userHandle, err5 := decodeBase64URL(req.Credential.Response.UserHandle)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || err5 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": "Invalid credential encoding"})
+		return
+	}
+
+	challenge, ok := consumeWebAuthnChallenge(c, models.WebAuthnLogin, clientDataJSON)
+	if !ok {
+		return
+	}
+
+	invalid := func() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_credentials", "message": "Passkey verification failed"})
+	}
+
+	stored, err := models.FindWebAuthnCredential(credentialID)
+	if err != nil {
+		invalid()
+		return
+	}
+	if challenge.record.UserID != 0 && challenge.record.UserID != stored.UserID {
+		invalid()
+		return
+	}
+	if len(userHandle) > 0 && !bytes.Equal(userHandle, webAuthnUserHandle(stored.UserID)) {
+		invalid()
+		return
+	}
+
+	user, err := models.FindUserByID(stored.UserID)
+	if err != nil {
+		invalid()
+		return
+	}
+
+	// 指定了用户名时登录选项已按是否启用两步验证要求用户验证，此处同样强制校验
+	requireUserVerification := challenge.record.UserID != 0 && user.TOTPEnabled
+	signCount, err := rp.VerifyAssertion(challenge.value, webauthn.Credential{
+		ID:        stored.CredentialID,
+		PublicKey: stored.PublicKey,
+		SignCount: stored.SignCount,
+	}, clientDataJSON, authenticatorData, signature, requireUserVerification)
+	if err != nil {
+		invalid()
+		return
+	}
+
+	if err := models.UpdateWebAuthnSignCount(stored.ID, stored.SignCount, signCount); err != nil {
+		invalid()
+		return
+	}
+
+	if !checkUserEnabled(c, user) {
+		return
+	}
+
+	// 未经用户验证的通行密钥只相当于持有因素，启用了两步验证时继续要求验证码
+	if user.TOTPEnabled && !webauthn.UserVerified(authenticatorData) {
+		twoFactorChallenge, err := generateTwoFactorChallenge(user.ID, req.DeviceName)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "token_generation_failed", "message": "Failed to generate token"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"challenge_token":     twoFactorChallenge,
+			"expires_in":          int(twoFactorChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	tokens, err := issueTokens(c, user, req.DeviceName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "token_generation_failed", "message": "Failed to generate token"})
+		return
+	}
+
+	tokens["user"] = gin.H{
+		"id":       user.ID,
+		"username": user.Username,
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// GetWebAuthnCredentials 获取当前用户的通行密钥列表
+func GetWebAuthnCredentials(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	credentials, err := models.GetWebAuthnCredentialsByUserID(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed_to_fetch", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, credentials)
+}
+
+// DeleteWebAuthnCredential 删除通行密钥
+func DeleteWebAuthnCredential(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": "Invalid credential ID"})
+		return
+	}
+
+	if err := models.DeleteWebAuthnCredential(uint(id), user.ID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found", "message": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Passkey deleted successfully"})
+}
+
+// 读取依赖方配置，未配置时返回404
+func webAuthnConfig(c *gin.Context) (webauthn.Config, bool) {
+	rpID := config.GetWebAuthnRPID()
+	if rpID == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webauthn_disabled", "message": "Passkey login is not configured"})
+		return webauthn.Config{}, false
+	}
+
+	return webauthn.Config{
+		RPID:    rpID,
+		RPName:  config.GetWebAuthnRPName(),
+		Origins: config.GetWebAuthnOrigins(),
+	}, true
+}
+
+// 生成并保存一次性挑战
+func newWebAuthnChallenge(userID uint, purpose string) ([]byte, error) {
+	challenge, err := webauthn.GenerateChallenge()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := models.CreateWebAuthnChallenge(userID, purpose, challenge, webAuthnChallengeTTL); err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+type webAuthnChallenge struct {
+	value  []byte
+	record *models.WebAuthnChallenge
+}
+
+// 从clientDataJSON中取出挑战值并消费服务端保存的记录
+func consumeWebAuthnChallenge(c *gin.Context, purpose string, clientDataJSON []byte) (*webAuthnChallenge, bool) {
+	value, err := webauthn.ChallengeFromClientData(clientDataJSON)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": err.Error()})
+		return nil, false
+	}
+
+	record, err := models.ConsumeWebAuthnChallenge(purpose, value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_challenge", "message": "Invalid or expired challenge"})
+		return nil, false
+	}
+
+	return &webAuthnChallenge{value: value, record: record}, true
+}
+
+// 用户句柄为用户ID的8字节大端编码，不包含用户名等个人信息
+func webAuthnUserHandle(userID uint) []byte {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+	return handle
+}
+
+// 解码base64url，兼容带填充的写法
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
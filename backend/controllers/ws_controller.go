@@ -0,0 +1,399 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/weicopy/backend/config"
+	"github.com/weicopy/backend/events"
+	"github.com/weicopy/backend/middlewares"
+	"github.com/weicopy/backend/models"
+)
+
+// WebSocket连接参数
+const (
+	wsWriteTimeout = 10 * time.Second
+	wsPongTimeout  = 60 * time.Second
+	wsPingInterval = 25 * time.Second
+	wsSendBuffer   = 64
+)
+
+// WebSocket消息类型
+const (
+	wsMessageText  = "text"
+	wsMessageAck   = "ack"
+	wsMessageError = "error"
+	wsMessageReset = "reset"
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	// 认证通过令牌完成，不依赖Cookie，因此允许任意来源
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// 客户端发送的消息
+// 文本帧为JSON消息；二进制帧为一行JSON头部（以换行结尾）加文件内容
+type wsClientMessage struct {
+	Type      string `json:"type"`
+	ID        string `json:"id"`
+	Content   string `json:"content,omitempty"`
+	Filename  string `json:"filename,omitempty"`
+	MaxReads  int    `json:"max_reads,omitempty"`  // 阅后即焚的最大读取次数
+	ExpiresIn int    `json:"expires_in,omitempty"` // 保留秒数，为空时使用默认保留时长
+}
+
+// 由消息中的可选字段生成项目设置
+func (msg *wsClientMessage) itemOptions() (models.ItemOptions, error) {
+	opts := models.ItemOptions{MaxReads: msg.MaxReads}
+	if msg.MaxReads < 0 {
+		return opts, errors.New("max_reads must be a non-negative integer")
+	}
+	if msg.ExpiresIn < 0 {
+		return opts, errors.New("expires_in must be positive")
+	}
+	if msg.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(msg.ExpiresIn) * time.Second)
+		opts.ExpiresAt = &expiresAt
+	}
+	return opts, nil
+}
+
+// 服务端对客户端消息的确认或错误回复
+type wsReply struct {
+	Type string                `json:"type"`
+	ID   string                `json:"id,omitempty"`
+	Item *models.ClipboardItem `json:"item,omitempty"`
+	// 确认对应的项目ID，重复发送的消息即使项目已被删除也会返回原项目ID
+	ItemID string `json:"item_id,omitempty"`
+	// 消息ID此前已处理过，本次没有创建新项目
+	Duplicate bool   `json:"duplicate,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// SyncWebSocket 双向同步通道：推送本用户的剪贴板变更，并接收客户端上传的内容
+func SyncWebSocket(c *gin.Context) {
+	user, err := middlewares.GetCurrentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized", "message": err.Error()})
+		return
+	}
+
+	var lastID uint64
+	if str := c.Query("last_event_id"); str != "" {
+		lastID, err = strconv.ParseUint(str, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request", "message": "Invalid last_event_id"})
+			return
+		}
+	}
+
+	// 先订阅再补发，避免遗漏补发期间产生的事件
+	sub := events.Subscribe(user.ID)
+	defer sub.Close()
+
+	var backlog []events.Event
+	complete := true
+	if lastID > 0 {
+		backlog, complete, err = events.Replay(user.ID, lastID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed_to_fetch", "message": err.Error()})
+			return
+		}
+	}
+
+	canWrite := middlewares.HasScope(c, models.ScopeClipboardWrite)
+	deviceID := middlewares.GetCurrentDeviceID(c)
+	checkCredential := middlewares.CredentialChecker(c)
+
+	conn, err := wsUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade已向客户端写出错误响应
+		return
+	}
+	defer conn.Close()
+
+	conn.SetReadLimit(config.GetMaxWebSocketMessageSize() * 1024 * 1024)
+	conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+
+	send := make(chan interface{}, wsSendBuffer)
+	done := make(chan struct{})
+	defer close(done)
+
+	// 写协程：WebSocket连接同一时间只允许一个写入者
+	go func() {
+		ping := time.NewTicker(wsPingInterval)
+		defer ping.Stop()
+		credentialCheck := time.NewTicker(streamCredentialCheckInterval)
+		defer credentialCheck.Stop()
+		defer conn.Close()
+
+		write := func(v interface{}) bool {
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			return conn.WriteJSON(v) == nil
+		}
+
+		replayed := lastID
+		if !complete {
+			if !write(wsReply{Type: wsMessageReset}) {
+				return
+			}
+			replayed = 0
+		}
+		for _, event := range backlog {
+			if !write(event) {
+				return
+			}
+			replayed = event.ID
+		}
+
+		for {
+			select {
+			case <-done:
+				conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+				conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+				return
+			case event, ok := <-sub.C:
+				if !ok {
+					// 推送过慢被广播器断开，客户端应携带last_event_id重连
+					return
+				}
+				// 跳过已经补发过的事件
+				if event.ID <= replayed {
+					continue
+				}
+				if !write(event) {
+					return
+				}
+			case reply := <-send:
+				if !write(reply) {
+					return
+				}
+			case <-ping.C:
+				conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+				if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+					return
+				}
+			case <-credentialCheck.C:
+				// 凭据已失效时关闭连接，关闭后读循环随之退出
+				if err := checkCredential(); err != nil {
+					conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+					conn.WriteMessage(websocket.CloseMessage,
+						websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error()))
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		// 上传内容需要写入权限
+		if !canWrite && (messageType == websocket.TextMessage || messageType == websocket.BinaryMessage) {
+			reply := wsError("", "insufficient_scope", "Token is missing required scope: "+models.ScopeClipboardWrite)
+			select {
+			case send <- reply:
+			case <-time.After(wsWriteTimeout):
+				return
+			}
+			continue
+		}
+
+		var reply wsReply
+		switch messageType {
+		case websocket.TextMessage:
+			reply = handleWSTextMessage(user.ID, deviceID, data)
+		case websocket.BinaryMessage:
+			reply = handleWSBinaryMessage(user.ID, deviceID, data)
+		default:
+			continue
+		}
+
+		select {
+		case send <- reply:
+		case <-time.After(wsWriteTimeout):
+			// 客户端长时间不读取回复，断开连接
+			return
+		}
+	}
+}
+
+// 处理JSON文本帧
+func handleWSTextMessage(userID uint, deviceID string, data []byte) wsReply {
+	var msg wsClientMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return wsError("", "invalid_request", "Message must be valid JSON")
+	}
+
+	switch msg.Type {
+	case wsMessageText:
+		if msg.Content == "" {
+			return wsError(msg.ID, "invalid_request", "Text content cannot be empty")
+		}
+		opts, err := msg.itemOptions()
+		if err != nil {
+			return wsError(msg.ID, "invalid_request", err.Error())
+		}
+		return createWSItem(userID, msg.ID, func() (*models.ClipboardItem, []*models.ClipboardTombstone, error) {
+			return models.CreateTextItem(userID, deviceID, msg.Content, opts)
+		})
+	default:
+		return wsError(msg.ID, "invalid_request", "Unsupported message type")
+	}
+}
+
+// 处理二进制帧：第一行为JSON头部，其余为文件内容
+func handleWSBinaryMessage(userID uint, deviceID string, data []byte) wsReply {
+	newline := bytes.IndexByte(data, '\n')
+	if newline < 0 {
+		return wsError("", "invalid_request", "Binary frame must start with a JSON header line")
+	}
+
+	var msg wsClientMessage
+	if err := json.Unmarshal(data[:newline], &msg); err != nil {
+		return wsError("", "invalid_request", "Invalid binary frame header")
+	}
+	payload := data[newline+1:]
+	if len(payload) == 0 {
+		return wsError(msg.ID, "invalid_request", "File content cannot be empty")
+	}
+	opts, err := msg.itemOptions()
+	if err != nil {
+		return wsError(msg.ID, "invalid_request", err.Error())
+	}
+
+	// 根据内容判断是否为图片
+	contentType := http.DetectContentType(payload)
+	isImage := strings.HasPrefix(contentType, "image/")
+
+	var filename string
+	if msg.Filename != "" {
+		filename = filepath.Base(msg.Filename)
+	}
+	extension := filepath.Ext(filename)
+	if extension == "" {
+		extension = ".bin"
+		if isImage {
+			extension = imageExtension(contentType)
+		}
+	}
+	if filename == "" {
+		filename = "file" + extension
+		if isImage {
+			filename = "image" + extension
+		}
+	}
+
+	return createWSItem(userID, msg.ID, func() (*models.ClipboardItem, []*models.ClipboardTombstone, error) {
+		size := int64(len(payload))
+		if err := models.CheckStorageQuota(userID, size); err != nil {
+			return nil, nil, err
+		}
+		fileKey, err := saveUploadedFile(context.Background(), bytes.NewReader(payload), size, extension)
+		if err != nil {
+			return nil, nil, err
+		}
+		item, trimmed, err := models.CreateFileItem(userID, deviceID, filename, fileKey, size, isImage, opts)
+		if err != nil {
+			models.DeleteStoredFile(fileKey)
+		}
+		return item, trimmed, err
+	})
+}
+
+// 创建项目并生成确认回复；同一消息ID重复发送时确认原项目，不再创建新项目
+// 原项目已被删除、读完或因数量上限被清理时只返回其ID，避免重发的消息重新创建已删除的内容
+func createWSItem(userID uint, messageID string, create func() (*models.ClipboardItem, []*models.ClipboardTombstone, error)) wsReply {
+	if messageID != "" {
+		if itemID, ok := wsDeliveries.lookup(userID, messageID); ok {
+			reply := wsReply{Type: wsMessageAck, ID: messageID, ItemID: itemID, Duplicate: true}
+			if item, err := models.GetClipboardItemByID(itemID); err == nil && item.UserID == userID {
+				reply.Item = item
+			}
+			return reply
+		}
+	}
+
+	item, trimmed, err := create()
+	if err != nil {
+		return wsError(messageID, createErrorCode(err), err.Error())
+	}
+
+	if messageID != "" {
+		wsDeliveries.remember(userID, messageID, item.ID)
+	}
+	publishCreatedItem(userID, item, trimmed)
+
+	return wsReply{Type: wsMessageAck, ID: messageID, Item: item, ItemID: item.ID}
+}
+
+func wsError(messageID, code, message string) wsReply {
+	return wsReply{Type: wsMessageError, ID: messageID, Error: code, Message: message}
+}
+
+// 记录最近处理过的客户端消息ID，用于客户端未收到确认而重发时去重
+type deliveryCache struct {
+	mu      sync.Mutex
+	entries map[uint]map[string]deliveryEntry
+}
+
+type deliveryEntry struct {
+	itemID    string
+	createdAt time.Time
+}
+
+// 消息ID的去重保留时间
+const deliveryTTL = 10 * time.Minute
+
+var wsDeliveries = &deliveryCache{entries: make(map[uint]map[string]deliveryEntry)}
+
+func (d *deliveryCache) lookup(userID uint, messageID string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entry, ok := d.entries[userID][messageID]
+	if !ok || time.Since(entry.createdAt) > deliveryTTL {
+		return "", false
+	}
+	return entry.itemID, true
+}
+
+func (d *deliveryCache) remember(userID uint, messageID, itemID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entries, ok := d.entries[userID]
+	if !ok {
+		entries = make(map[string]deliveryEntry)
+		d.entries[userID] = entries
+	}
+
+	// 顺便清理过期记录
+	for id, entry := range entries {
+		if time.Since(entry.createdAt) > deliveryTTL {
+			delete(entries, id)
+		}
+	}
+
+	entries[messageID] = deliveryEntry{itemID: itemID, createdAt: time.Now()}
+}
@@ -0,0 +1,155 @@
+package events
+
+import (
+	"sync"
+
+	"github.com/weicopy/backend/models"
+)
+
+// 事件类型，与变更记录类型一致
+const (
+	TypeCreated = models.ChangeCreated
+	TypeDeleted = models.ChangeDeleted
+)
+
+// 断线重连时单次最多补发的事件数量，超出时客户端应重新拉取完整列表
+const replayLimit = 500
+
+// 每个订阅者的缓冲区大小，写满后订阅会被关闭，由客户端重连补发
+const subscriberBufferSize = 64
+
+// Event 剪贴板变更事件，ID为用户的变更序号
+type Event struct {
+	ID     uint64                `json:"id"`
+	Type   string                `json:"type"`
+	ItemID string                `json:"item_id"`
+	Item   *models.ClipboardItem `json:"item,omitempty"`
+}
+
+// Subscription 单个连接对某个用户事件流的订阅
+type Subscription struct {
+	C <-chan Event
+
+	ch          chan Event
+	userID      uint
+	broadcaster *Broadcaster
+	closeOnce   sync.Once
+}
+
+// Broadcaster 进程内的按用户划分的事件广播器
+type Broadcaster struct {
+	mu          sync.Mutex
+	subscribers map[uint]map[*Subscription]struct{}
+}
+
+// NewBroadcaster 创建事件广播器
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{subscribers: make(map[uint]map[*Subscription]struct{})}
+}
+
+// 默认广播器，供控制器使用
+var defaultBroadcaster = NewBroadcaster()
+
+// Publish 向默认广播器发布变更
+func Publish(userID uint, change models.ClipboardChange) {
+	defaultBroadcaster.Publish(userID, change)
+}
+
+// Subscribe 订阅默认广播器中某个用户的事件
+func Subscribe(userID uint) *Subscription {
+	return defaultBroadcaster.Subscribe(userID)
+}
+
+// Replay 从数据库读取序号大于lastEventID的变更用于补发
+// 第二个返回值为false时表示无法完整补发，客户端应重新拉取完整列表
+func Replay(userID uint, lastEventID uint64) ([]Event, bool, error) {
+	seq, err := models.GetClipboardSeq(userID)
+	if err != nil {
+		return nil, false, err
+	}
+	// 序号大于当前值说明数据已被重置
+	if lastEventID > seq {
+		return nil, false, nil
+	}
+
+	changes, hasMore, err := models.GetClipboardChanges(userID, lastEventID, replayLimit)
+	if err != nil {
+		return nil, false, err
+	}
+	if hasMore {
+		return nil, false, nil
+	}
+
+	backlog := make([]Event, 0, len(changes))
+	for _, change := range changes {
+		backlog = append(backlog, newEvent(change))
+	}
+	return backlog, true, nil
+}
+
+// Publish 发布变更给该用户的所有订阅者
+func (b *Broadcaster) Publish(userID uint, change models.ClipboardChange) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	event := newEvent(change)
+	for sub := range b.subscribers[userID] {
+		select {
+		case sub.ch <- event:
+		default:
+			// 订阅者处理过慢，关闭订阅，客户端可通过Last-Event-ID重连补发
+			b.removeLocked(sub)
+		}
+	}
+}
+
+// Subscribe 订阅用户事件
+func (b *Broadcaster) Subscribe(userID uint) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, subscriberBufferSize)
+	sub := &Subscription{
+		C:           ch,
+		ch:          ch,
+		userID:      userID,
+		broadcaster: b,
+	}
+
+	subscribers, ok := b.subscribers[userID]
+	if !ok {
+		subscribers = make(map[*Subscription]struct{})
+		b.subscribers[userID] = subscribers
+	}
+	subscribers[sub] = struct{}{}
+
+	return sub
+}
+
+// Close 取消订阅
+func (s *Subscription) Close() {
+	s.broadcaster.mu.Lock()
+	defer s.broadcaster.mu.Unlock()
+	s.broadcaster.removeLocked(s)
+}
+
+func (b *Broadcaster) removeLocked(sub *Subscription) {
+	sub.closeOnce.Do(func() {
+		if subscribers, ok := b.subscribers[sub.userID]; ok {
+			delete(subscribers, sub)
+			if len(subscribers) == 0 {
+				delete(b.subscribers, sub.userID)
+			}
+		}
+		close(sub.ch)
+	})
+}
+
+func newEvent(change models.ClipboardChange) Event {
+	return Event{
+		ID:     change.Seq,
+		Type:   change.Type,
+		ItemID: change.ItemID,
+		Item:   change.Item,
+	}
+}
@@ -0,0 +1,33 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminRequired 管理员中间件，需在AuthRequired之后使用，仅允许管理员角色的用户访问
+func AdminRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := GetCurrentUser(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":   "unauthorized",
+				"message": err.Error(),
+			})
+			c.Abort()
+			return
+		}
+
+		if !user.IsAdmin() {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "admin_required",
+				"message": "Administrator privileges are required",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -13,11 +13,12 @@ import (
 
 // 用于JWT的声明结构
 type Claims struct {
-	UserID uint `json:"user_id"`
+	UserID    uint   `json:"user_id"`
+	SessionID string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-// AuthRequired 认证中间件，确保请求包含有效的JWT令牌
+// AuthRequired 认证中间件，确保请求包含有效的JWT令牌或个人访问令牌
 func AuthRequired() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		user, err := getUserFromToken(c)
@@ -29,25 +30,68 @@ func AuthRequired() gin.HandlerFunc {
 
 		// 将用户信息存储在上下文中
 		c.Set("user", user)
+		if _, exists := c.Get("scopes"); !exists {
+			// 登录获得的JWT拥有全部权限
+			c.Set("scopes", models.AllScopes)
+		}
+		setCurrentDevice(c, user)
 		c.Next()
 	}
 }
 
-// 从请求中提取和验证JWT令牌
-func getUserFromToken(c *gin.Context) (*models.User, error) {
-	// 从Authorization头部获取令牌
-	authorization := c.GetHeader("Authorization")
-	if authorization == "" {
-		return nil, errors.New("authorization header is required")
+// CredentialChecker 返回重新校验本次请求所用凭据的函数，供事件流等长连接定期调用
+// 连接只在建立时经过认证，退出登录、撤销会话或令牌、删除设备和停用账户后需借此断开已有连接
+func CredentialChecker(c *gin.Context) func() error {
+	var userID uint
+	if user, err := GetCurrentUser(c); err == nil {
+		userID = user.ID
+	}
+	var sessionID string
+	if session, err := GetCurrentSession(c); err == nil {
+		sessionID = session.ID
+	}
+	var tokenID uint
+	if value, exists := c.Get("api_token"); exists {
+		if apiToken, ok := value.(*models.APIToken); ok {
+			tokenID = apiToken.ID
+		}
 	}
 
-	// 检查格式是否为"Bearer {token}"
-	parts := strings.SplitN(authorization, " ", 2)
-	if !(len(parts) == 2 && parts[0] == "Bearer") {
-		return nil, errors.New("authorization header format must be Bearer {token}")
+	return func() error {
+		if sessionID != "" {
+			session, err := models.FindSessionByID(sessionID)
+			if err != nil || session.UserID != userID || !session.IsActive() {
+				return errors.New("session expired or revoked")
+			}
+		} else {
+			apiToken, err := models.FindAPITokenByID(tokenID)
+			if err != nil || apiToken.UserID != userID {
+				return errors.New("invalid or expired token")
+			}
+		}
+
+		user, err := models.FindUserByID(userID)
+		if err != nil {
+			return errors.New("user not found")
+		}
+		if user.IsDisabled() {
+			return errors.New("account disabled")
+		}
+		return nil
+	}
+}
+
+// 从请求中提取和验证令牌
+func getUserFromToken(c *gin.Context) (*models.User, error) {
+	tokenString, err := extractToken(c)
+	if err != nil {
+		return nil, err
 	}
 
-	tokenString := parts[1]
+	// 个人访问令牌
+	if strings.HasPrefix(tokenString, models.APITokenPrefix) {
+		return getUserFromAPIToken(c, tokenString)
+	}
 
 	// 解析JWT令牌
 	claims := &Claims{}
@@ -67,15 +111,134 @@ func getUserFromToken(c *gin.Context) (*models.User, error) {
 		return nil, errors.New("invalid token")
 	}
 
+	// 检查会话是否仍然有效，使退出登录立即生效
+	session, err := models.FindSessionByID(claims.SessionID)
+	if err != nil || session.UserID != claims.UserID || !session.IsActive() {
+		return nil, errors.New("session expired or revoked")
+	}
+
 	// 获取用户信息
 	user, err := models.FindUserByID(claims.UserID)
 	if err != nil {
 		return nil, errors.New("user not found")
 	}
+	if user.IsDisabled() {
+		return nil, errors.New("account disabled")
+	}
+
+	c.Set("session", session)
+	return user, nil
+}
+
+// 验证个人访问令牌，并将令牌记录存入上下文
+func getUserFromAPIToken(c *gin.Context, tokenString string) (*models.User, error) {
+	apiToken, err := models.FindAPITokenByPlaintext(tokenString)
+	if err != nil {
+		return nil, errors.New("invalid or expired token")
+	}
+
+	user, err := models.FindUserByID(apiToken.UserID)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	if user.IsDisabled() {
+		return nil, errors.New("account disabled")
+	}
+
+	// 更新最近使用时间失败不影响本次请求
+	models.TouchAPIToken(apiToken)
 
+	c.Set("api_token", apiToken)
+	c.Set("scopes", apiToken.Scopes)
 	return user, nil
 }
 
+// 从请求中提取令牌字符串
+func extractToken(c *gin.Context) (string, error) {
+	// 从Authorization头部获取令牌
+	authorization := c.GetHeader("Authorization")
+	if authorization == "" {
+		// 浏览器的EventSource和WebSocket无法设置请求头，允许长连接通过查询参数传递令牌
+		if isStreamRequest(c) {
+			if token := c.Query("access_token"); token != "" {
+				return token, nil
+			}
+		}
+		return "", errors.New("authorization header is required")
+	}
+
+	// 检查格式是否为"Bearer {token}"
+	parts := strings.SplitN(authorization, " ", 2)
+	if !(len(parts) == 2 && parts[0] == "Bearer") {
+		return "", errors.New("authorization header format must be Bearer {token}")
+	}
+
+	return parts[1], nil
+}
+
+// 判断是否为长连接请求（事件流或WebSocket）
+func isStreamRequest(c *gin.Context) bool {
+	if c.Request.Method != http.MethodGet {
+		return false
+	}
+	return strings.Contains(c.GetHeader("Accept"), "text/event-stream") ||
+		strings.EqualFold(c.GetHeader("Upgrade"), "websocket")
+}
+
+// 根据会话或个人访问令牌确定请求来源设备，并更新其在线状态
+func setCurrentDevice(c *gin.Context, user *models.User) {
+	var deviceID string
+	if session, err := GetCurrentSession(c); err == nil {
+		deviceID = session.DeviceID
+	} else if value, exists := c.Get("api_token"); exists {
+		if apiToken, ok := value.(*models.APIToken); ok {
+			deviceID = apiToken.DeviceID
+		}
+	}
+	if deviceID == "" {
+		return
+	}
+
+	device, err := models.FindDeviceByID(deviceID, user.ID)
+	if err != nil {
+		return
+	}
+
+	// 更新在线状态失败不影响本次请求
+	models.TouchDevice(device, c.ClientIP())
+	c.Set("device", device)
+}
+
+// GetCurrentDeviceID 获取当前请求来源设备的ID，未关联设备时返回空字符串
+func GetCurrentDeviceID(c *gin.Context) string {
+	value, exists := c.Get("device")
+	if !exists {
+		return ""
+	}
+
+	device, ok := value.(*models.Device)
+	if !ok {
+		return ""
+	}
+
+	return device.ID
+}
+
+// GetCurrentSession 从上下文中获取当前登录会话，使用个人访问令牌时不存在
+func GetCurrentSession(c *gin.Context) (*models.Session, error) {
+	value, exists := c.Get("session")
+	if !exists {
+		return nil, errors.New("request is not authenticated with a session token")
+	}
+
+	session, ok := value.(*models.Session)
+	if !ok {
+		return nil, errors.New("session in context is not valid")
+	}
+
+	return session, nil
+}
+
 // GetCurrentUser 从上下文中获取当前用户
 func GetCurrentUser(c *gin.Context) (*models.User, error) {
 	user, exists := c.Get("user")
@@ -0,0 +1,44 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/weicopy/backend/models"
+)
+
+// RequireScope 权限范围中间件，需在AuthRequired之后使用
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasScope(c, scope) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":          "insufficient_scope",
+				"message":        "Token is missing required scope: " + scope,
+				"required_scope": scope,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// HasScope 当前请求的令牌是否拥有指定权限范围
+func HasScope(c *gin.Context, scope string) bool {
+	return GetCurrentScopes(c).Has(scope)
+}
+
+// GetCurrentScopes 从上下文中获取当前令牌的权限范围
+func GetCurrentScopes(c *gin.Context) models.Scopes {
+	value, exists := c.Get("scopes")
+	if !exists {
+		return nil
+	}
+
+	scopes, ok := value.(models.Scopes)
+	if !ok {
+		return nil
+	}
+
+	return scopes
+}
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APITokenPrefix 个人访问令牌的固定前缀，用于与JWT区分
+const APITokenPrefix = "wcp_"
+
+// 最近使用时间的更新间隔，避免每次请求都写数据库
+const apiTokenTouchInterval = time.Minute
+
+// APIToken 个人访问令牌模型，仅保存令牌的哈希值
+type APIToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index;not null" json:"user_id"`
+	DeviceID   string     `gorm:"type:varchar(36);index" json:"device_id"`
+	Name       string     `gorm:"size:100;not null" json:"name"`
+	Prefix     string     `gorm:"size:20;not null" json:"prefix"`
+	TokenHash  string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	Scopes     Scopes     `gorm:"type:varchar(255);not null;default:'clipboard:read clipboard:write clipboard:delete'" json:"scopes"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// IsExpired 令牌是否已过期
+func (t *APIToken) IsExpired() bool {
+	return t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt)
+}
+
+// CreateAPIToken 创建个人访问令牌，返回令牌记录和仅此一次可见的明文令牌
+func CreateAPIToken(userID uint, deviceID, name string, scopes Scopes, expiresAt *time.Time) (*APIToken, string, error) {
+	token, plaintext, err := newAPIToken(userID, deviceID, name, scopes, expiresAt)
+	if err != nil {
+		return nil, "", err
+	}
+
+	result := DB.Create(token)
+	if result.Error != nil {
+		return nil, "", result.Error
+	}
+
+	return token, plaintext, nil
+}
+
+// GetAPITokensByUserID 获取用户的所有个人访问令牌
+func GetAPITokensByUserID(userID uint) ([]APIToken, error) {
+	var tokens []APIToken
+	result := DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return tokens, nil
+}
+
+// FindAPITokenByPlaintext 通过明文令牌查找有效的个人访问令牌
+func FindAPITokenByPlaintext(plaintext string) (*APIToken, error) {
+	if !strings.HasPrefix(plaintext, APITokenPrefix) {
+		return nil, errors.New("api token not found")
+	}
+
+	var token APIToken
+	result := DB.Where("token_hash = ?", hashToken(plaintext)).First(&token)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errors.New("api token not found")
+		}
+		return nil, result.Error
+	}
+
+	if token.IsExpired() {
+		return nil, errors.New("api token expired")
+	}
+
+	return &token, nil
+}
+
+// FindAPITokenByID 通过ID查找未过期的个人访问令牌，已撤销的令牌记录已被删除
+func FindAPITokenByID(id uint) (*APIToken, error) {
+	var token APIToken
+	result := DB.Where("id = ?", id).First(&token)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errors.New("api token not found")
+		}
+		return nil, result.Error
+	}
+
+	if token.IsExpired() {
+		return nil, errors.New("api token expired")
+	}
+
+	return &token, nil
+}
+
+// TouchAPIToken 更新令牌的最近使用时间
+func TouchAPIToken(token *APIToken) error {
+	now := time.Now()
+	if token.LastUsedAt != nil && now.Sub(*token.LastUsedAt) < apiTokenTouchInterval {
+		return nil
+	}
+
+	result := DB.Model(token).UpdateColumn("last_used_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	token.LastUsedAt = &now
+	return nil
+}
+
+// DeleteAPIToken 撤销个人访问令牌
+func DeleteAPIToken(id uint, userID uint) error {
+	result := DB.Where("id = ? AND user_id = ?", id, userID).Delete(&APIToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("api token not found or not owned by user")
+	}
+
+	return nil
+}
+
+// 生成新的令牌记录和明文令牌（尚未保存）
+func newAPIToken(userID uint, deviceID, name string, scopes Scopes, expiresAt *time.Time) (*APIToken, string, error) {
+	secret, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+	plaintext := APITokenPrefix + secret
+
+	return &APIToken{
+		UserID:    userID,
+		DeviceID:  deviceID,
+		Name:      name,
+		Prefix:    plaintext[:len(APITokenPrefix)+8],
+		TokenHash: hashToken(plaintext),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}, plaintext, nil
+}
+
+// 生成32字节的随机令牌
+func randomToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// 令牌本身为高熵随机值，使用SHA-256哈希即可安全存储
+func hashToken(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 变更类型
+const (
+	ChangeCreated = "created"
+	ChangeDeleted = "deleted"
+)
+
+// ClipboardTombstone 已删除项目的墓碑记录，供离线设备同步删除
+type ClipboardTombstone struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	UserID    uint      `gorm:"index:idx_tombstone_user_seq;not null" json:"user_id"`
+	Seq       uint64    `gorm:"index:idx_tombstone_user_seq;not null" json:"seq"`
+	ItemID    string    `gorm:"type:varchar(36);not null" json:"item_id"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// ClipboardChange 变更记录，创建时附带项目内容，删除时仅包含项目ID
+type ClipboardChange struct {
+	Seq    uint64         `json:"seq"`
+	Type   string         `json:"type"`
+	ItemID string         `json:"item_id"`
+	Item   *ClipboardItem `json:"item,omitempty"`
+}
+
+// CreatedChange 由新建的项目生成变更记录
+func CreatedChange(item *ClipboardItem) ClipboardChange {
+	return ClipboardChange{Seq: item.Seq, Type: ChangeCreated, ItemID: item.ID, Item: item}
+}
+
+// DeletedChange 由墓碑记录生成变更记录
+func DeletedChange(tombstone *ClipboardTombstone) ClipboardChange {
+	return ClipboardChange{Seq: tombstone.Seq, Type: ChangeDeleted, ItemID: tombstone.ItemID}
+}
+
+// GetClipboardChanges 获取用户序号大于since的变更，按序号升序返回，最多limit条
+// 第二个返回值表示是否还有更多变更
+func GetClipboardChanges(userID uint, since uint64, limit int) ([]ClipboardChange, bool, error) {
+	var items []ClipboardItem
+	result := DB.Where("user_id = ? AND seq > ?", userID, since).Order("seq ASC").Limit(limit + 1).Find(&items)
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+
+	var tombstones []ClipboardTombstone
+	result = DB.Where("user_id = ? AND seq > ?", userID, since).Order("seq ASC").Limit(limit + 1).Find(&tombstones)
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+
+	changes := make([]ClipboardChange, 0, len(items)+len(tombstones))
+	for i := range items {
+		changes = append(changes, CreatedChange(&items[i]))
+	}
+	for i := range tombstones {
+		changes = append(changes, DeletedChange(&tombstones[i]))
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Seq < changes[j].Seq })
+
+	hasMore := len(changes) > limit
+	if hasMore {
+		changes = changes[:limit]
+	}
+	return changes, hasMore, nil
+}
+
+// GetClipboardSeq 获取用户当前的最新变更序号
+func GetClipboardSeq(userID uint) (uint64, error) {
+	var seq uint64
+	result := DB.Model(&User{}).Select("clipboard_seq").Where("id = ?", userID).Scan(&seq)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return seq, nil
+}
+
+// 在事务中为用户分配下一个变更序号
+func nextClipboardSeq(tx *gorm.DB, userID uint) (uint64, error) {
+	result := tx.Model(&User{}).Where("id = ?", userID).
+		UpdateColumn("clipboard_seq", gorm.Expr("clipboard_seq + 1"))
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	var seq uint64
+	result = tx.Model(&User{}).Select("clipboard_seq").Where("id = ?", userID).Scan(&seq)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return seq, nil
+}
+
+// 为升级前创建、尚无序号的项目按创建时间补充序号
+func backfillClipboardSeq() error {
+	var items []ClipboardItem
+	if err := DB.Where("seq = 0").Order("created_at ASC").Find(&items).Error; err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			seq, err := nextClipboardSeq(tx, item.UserID)
+			if err != nil {
+				return err
+			}
+			return tx.Model(&ClipboardItem{}).Where("id = ?", item.ID).UpdateColumn("seq", seq).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,10 +1,16 @@
 package models
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"log"
+	"path/filepath"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/weicopy/backend/config"
+	"github.com/weicopy/backend/storage"
 	"gorm.io/gorm"
 )
 
@@ -17,14 +23,46 @@ const (
 
 // ClipboardItem 剪贴板项目模型
 type ClipboardItem struct {
-	ID        string    `gorm:"primaryKey;type:varchar(36)" json:"id"`
-	UserID    uint      `gorm:"index;not null" json:"user_id"`
-	Type      string    `gorm:"size:10;not null" json:"type"`
-	Content   string    `gorm:"type:text" json:"content"`
-	Filename  string    `gorm:"size:255" json:"filename,omitempty"`
-	FilePath  string    `gorm:"size:255" json:"-"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        string     `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	Seq       uint64     `gorm:"index;not null;default:0" json:"seq"`
+	DeviceID  string     `gorm:"type:varchar(36);index" json:"device_id,omitempty"`
+	Type      string     `gorm:"size:10;not null" json:"type"`
+	Content   string     `gorm:"type:text" json:"content"`
+	Filename  string     `gorm:"size:255" json:"filename,omitempty"`
+	FilePath  string     `gorm:"size:255" json:"-"`                   // 文件在存储后端中的键
+	Size      int64      `gorm:"not null;default:0" json:"size"`      // 文本为字节数，文件为文件大小
+	MaxReads  int        `gorm:"not null;default:0" json:"max_reads"` // 阅后即焚的最大读取次数，0表示不限
+	Reads     int        `gorm:"not null;default:0" json:"reads"`
+	ExpiresAt *time.Time `gorm:"index" json:"expires_at"`              // 过期后由后台任务删除，为空表示永不过期
+	Pinned    bool       `gorm:"not null;default:false" json:"pinned"` // 置顶的项目不会因历史数量上限被删除
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// ErrItemConsumed 阅后即焚项目已被读取完毕
+var ErrItemConsumed = errors.New("clipboard item not found or already read")
+
+// ItemOptions 创建剪贴板项目时的可选设置
+type ItemOptions struct {
+	// 最大读取次数，达到后项目和文件被删除，0表示不限
+	MaxReads int
+	// 过期时间，为空时使用用户或服务端的默认保留时长
+	ExpiresAt *time.Time
+}
+
+// IsBurnAfterRead 是否为阅后即焚项目
+func (ci *ClipboardItem) IsBurnAfterRead() bool {
+	return ci.MaxReads > 0
+}
+
+// MarshalJSON 阅后即焚的文本内容只能通过读取接口获取，不在列表、变更和事件中返回
+func (ci ClipboardItem) MarshalJSON() ([]byte, error) {
+	type item ClipboardItem
+	if ci.IsBurnAfterRead() {
+		ci.Content = ""
+	}
+	return json.Marshal(item(ci))
 }
 
 // BeforeCreate 创建前的钩子，用于生成UUID
@@ -36,7 +74,7 @@ func (ci *ClipboardItem) BeforeCreate(tx *gorm.DB) error {
 // GetClipboardItemsByUserID 获取用户的所有剪贴板项目
 func GetClipboardItemsByUserID(userID uint) ([]ClipboardItem, error) {
 	var items []ClipboardItem
-	result := DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&items)
+	result := DB.Scopes(notExpired).Where("user_id = ?", userID).Order("created_at DESC").Find(&items)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -46,7 +84,7 @@ func GetClipboardItemsByUserID(userID uint) ([]ClipboardItem, error) {
 // GetLatestClipboardItemByUserID 获取用户的最新剪贴板项目
 func GetLatestClipboardItemByUserID(userID uint) (*ClipboardItem, error) {
 	var item ClipboardItem
-	result := DB.Where("user_id = ?", userID).Order("created_at DESC").First(&item)
+	result := DB.Scopes(notExpired).Where("user_id = ?", userID).Order("created_at DESC").First(&item)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, errors.New("no clipboard items found")
@@ -59,7 +97,7 @@ func GetLatestClipboardItemByUserID(userID uint) (*ClipboardItem, error) {
 // GetClipboardItemByID 通过ID获取剪贴板项目
 func GetClipboardItemByID(id string) (*ClipboardItem, error) {
 	var item ClipboardItem
-	result := DB.Where("id = ?", id).First(&item)
+	result := DB.Scopes(notExpired).Where("id = ?", id).First(&item)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, errors.New("clipboard item not found")
@@ -69,54 +107,409 @@ func GetClipboardItemByID(id string) (*ClipboardItem, error) {
 	return &item, nil
 }
 
-// CreateTextItem 创建文本类型的剪贴板项目
-func CreateTextItem(userID uint, content string) (*ClipboardItem, error) {
+// CreateTextItem 创建文本类型的剪贴板项目，同时返回因超出历史数量上限而被删除的项目的墓碑记录
+func CreateTextItem(userID uint, deviceID, content string, opts ItemOptions) (*ClipboardItem, []*ClipboardTombstone, error) {
 	item := ClipboardItem{
-		UserID:  userID,
-		Type:    TypeText,
-		Content: content,
+		UserID:    userID,
+		DeviceID:  deviceID,
+		Type:      TypeText,
+		Content:   content,
+		Size:      int64(len(content)),
+		MaxReads:  opts.MaxReads,
+		ExpiresAt: opts.ExpiresAt,
 	}
 
-	result := DB.Create(&item)
-	if result.Error != nil {
-		return nil, result.Error
+	trimmed, err := createClipboardItem(&item)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return &item, nil
+	return &item, trimmed, nil
 }
 
-// CreateFileItem 创建文件类型的剪贴板项目
-func CreateFileItem(userID uint, filename, filePath string, isImage bool) (*ClipboardItem, error) {
+// CreateFileItem 创建文件类型的剪贴板项目，同时返回因超出历史数量上限而被删除的项目的墓碑记录
+func CreateFileItem(userID uint, deviceID, filename, filePath string, size int64, isImage bool, opts ItemOptions) (*ClipboardItem, []*ClipboardTombstone, error) {
 	itemType := TypeFile
 	if isImage {
 		itemType = TypeImage
 	}
 
 	item := ClipboardItem{
-		UserID:   userID,
-		Type:     itemType,
-		Filename: filename,
-		FilePath: filePath,
+		UserID:    userID,
+		DeviceID:  deviceID,
+		Type:      itemType,
+		Filename:  filename,
+		FilePath:  filePath,
+		Size:      size,
+		MaxReads:  opts.MaxReads,
+		ExpiresAt: opts.ExpiresAt,
 	}
 
-	result := DB.Create(&item)
-	if result.Error != nil {
-		return nil, result.Error
+	trimmed, err := createClipboardItem(&item)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &item, trimmed, nil
+}
+
+// 在事务中分配变更序号并创建项目，未指定过期时间时使用默认保留时长
+// 创建后超出历史数量上限时删除最早的未置顶项目，文件在事务提交后删除
+// 超出配额时返回ErrStorageQuotaExceeded或ErrItemQuotaExceeded
+func createClipboardItem(item *ClipboardItem) ([]*ClipboardTombstone, error) {
+	var trimmed []*ClipboardTombstone
+	var fileKeys []string
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if item.ExpiresAt == nil {
+			ttl, err := itemTTL(tx, item.UserID)
+			if err != nil {
+				return err
+			}
+			if ttl > 0 {
+				expiresAt := time.Now().Add(ttl)
+				item.ExpiresAt = &expiresAt
+			}
+		}
+
+		seq, err := nextClipboardSeq(tx, item.UserID)
+		if err != nil {
+			return err
+		}
+		item.Seq = seq
+		if err := tx.Create(item).Error; err != nil {
+			return err
+		}
+
+		trimmed, fileKeys, err = trimClipboardHistory(tx, item.UserID)
+		if err != nil {
+			return err
+		}
+
+		// 在删除超出历史上限的项目后检查配额，超出时整个事务回滚
+		return checkQuota(tx, item.UserID, 0, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range fileKeys {
+		DeleteStoredFile(key)
+	}
+
+	return trimmed, nil
+}
+
+// 删除超出历史数量上限的最早的未置顶项目，返回墓碑记录和需要删除的文件
+func trimClipboardHistory(tx *gorm.DB, userID uint) ([]*ClipboardTombstone, []string, error) {
+	limit, err := historyLimit(tx, userID)
+	if err != nil || limit <= 0 {
+		return nil, nil, err
+	}
+
+	var count int64
+	if err := tx.Model(&ClipboardItem{}).Where("user_id = ? AND pinned = ?", userID, false).Count(&count).Error; err != nil {
+		return nil, nil, err
+	}
+	if count <= int64(limit) {
+		return nil, nil, nil
+	}
+
+	var items []ClipboardItem
+	if err := tx.Select("id", "file_path").
+		Where("user_id = ? AND pinned = ?", userID, false).
+		// 置顶或取消置顶会分配新的变更序号，按创建时间排序才能删除最早的项目
+		Order("created_at ASC, id ASC").
+		Limit(int(count) - limit).
+		Find(&items).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var tombstones []*ClipboardTombstone
+	var fileKeys []string
+	for _, old := range items {
+		tombstone, err := deleteClipboardItem(tx, old.ID, userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		tombstones = append(tombstones, tombstone)
+		if old.FilePath != "" {
+			fileKeys = append(fileKeys, old.FilePath)
+		}
+	}
+
+	return tombstones, fileKeys, nil
+}
+
+// SetClipboardItemPinned 置顶或取消置顶项目，并分配新的变更序号使其他设备同步该修改
+func SetClipboardItemPinned(id string, userID uint, pinned bool) (*ClipboardItem, error) {
+	var item ClipboardItem
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Scopes(notExpired).Where("id = ? AND user_id = ?", id, userID).First(&item).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("clipboard item not found")
+			}
+			return err
+		}
+
+		seq, err := nextClipboardSeq(tx, userID)
+		if err != nil {
+			return err
+		}
+
+		item.Pinned = pinned
+		item.Seq = seq
+		return tx.Model(&item).Select("pinned", "seq", "updated_at").Updates(&item).Error
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return &item, nil
 }
 
-// DeleteClipboardItem 删除剪贴板项目
-func DeleteClipboardItem(id string, userID uint) error {
-	result := DB.Where("id = ? AND user_id = ?", id, userID).Delete(&ClipboardItem{})
+// DeleteClipboardItem 删除剪贴板项目，并记录墓碑供变更同步使用
+func DeleteClipboardItem(id string, userID uint) (*ClipboardTombstone, error) {
+	var tombstone *ClipboardTombstone
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		tombstone, err = deleteClipboardItem(tx, id, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tombstone, nil
+}
+
+// ConsumeClipboardItemRead 记录阅后即焚项目的一次读取，达到最大次数时删除项目
+// 删除时返回墓碑记录，文件由调用方在读取完成后删除；已读完时返回ErrItemConsumed
+func ConsumeClipboardItemRead(item *ClipboardItem) (*ClipboardTombstone, error) {
+	var tombstone *ClipboardTombstone
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		// 以剩余次数作为条件递增，保证并发读取不会超出次数
+		result := tx.Model(&ClipboardItem{}).
+			Where("id = ? AND reads < max_reads", item.ID).
+			UpdateColumn("reads", gorm.Expr("reads + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrItemConsumed
+		}
+
+		var current ClipboardItem
+		if err := tx.Select("reads", "max_reads").Where("id = ?", item.ID).First(&current).Error; err != nil {
+			return err
+		}
+		if current.Reads < current.MaxReads {
+			return nil
+		}
+
+		var err error
+		tombstone, err = deleteClipboardItem(tx, item.ID, item.UserID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tombstone, nil
+}
+
+// ExpiredItem 已过期并被删除的项目
+type ExpiredItem struct {
+	UserID    uint
+	Tombstone *ClipboardTombstone
+}
+
+// DeleteExpiredClipboardItems 删除最多limit个已过期的项目及其文件，返回删除记录供通知客户端
+func DeleteExpiredClipboardItems(now time.Time, limit int) ([]ExpiredItem, error) {
+	var items []ClipboardItem
+	if err := DB.Select("id", "user_id", "file_path").
+		Where("expires_at IS NOT NULL AND expires_at <= ?", now).
+		Order("expires_at").
+		Limit(limit).
+		Find(&items).Error; err != nil {
+		return nil, err
+	}
+
+	var expired []ExpiredItem
+	for _, item := range items {
+		var tombstone *ClipboardTombstone
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			var err error
+			tombstone, err = deleteClipboardItem(tx, item.ID, item.UserID)
+			return err
+		})
+		if err != nil {
+			// 项目可能已被并发删除
+			continue
+		}
+
+		DeleteStoredFile(item.FilePath)
+		expired = append(expired, ExpiredItem{UserID: item.UserID, Tombstone: tombstone})
+	}
+
+	return expired, nil
+}
+
+// DeleteStoredFile 删除存储后端中的文件，失败时只记录日志并留下孤立文件
+func DeleteStoredFile(key string) {
+	if key == "" {
+		return
+	}
+	if err := storage.Default.Delete(context.Background(), key); err != nil {
+		log.Printf("Failed to remove file %s: %v", key, err)
+	}
+}
+
+// 排除已过期但尚未被后台任务删除的项目
+func notExpired(db *gorm.DB) *gorm.DB {
+	return db.Where("expires_at IS NULL OR expires_at > ?", time.Now())
+}
+
+// 获取用户新建项目的默认保留时长：用户设置优先，未设置时使用服务端配置，0表示永久保留
+func itemTTL(tx *gorm.DB, userID uint) (time.Duration, error) {
+	var user User
+	if err := tx.Select("item_ttl_hours").First(&user, userID).Error; err != nil {
+		return 0, err
+	}
+	if user.ItemTTLHours != nil {
+		return time.Duration(*user.ItemTTLHours) * time.Hour, nil
+	}
+	return config.GetDefaultItemTTL(), nil
+}
+
+// 获取用户保留的最大历史项目数：用户设置优先，未设置时使用服务端配置，0表示不限
+func historyLimit(tx *gorm.DB, userID uint) (int, error) {
+	var user User
+	if err := tx.Select("max_history_items").First(&user, userID).Error; err != nil {
+		return 0, err
+	}
+	if user.MaxHistoryItems != nil {
+		return *user.MaxHistoryItems, nil
+	}
+	return config.GetDefaultMaxHistoryItems(), nil
+}
+
+// 在事务中删除项目及其分享链接，并记录墓碑
+func deleteClipboardItem(tx *gorm.DB, id string, userID uint) (*ClipboardTombstone, error) {
+	result := tx.Where("id = ? AND user_id = ?", id, userID).Delete(&ClipboardItem{})
 	if result.Error != nil {
-		return result.Error
+		return nil, result.Error
 	}
 
 	if result.RowsAffected == 0 {
-		return errors.New("clipboard item not found or not owned by user")
+		return nil, errors.New("clipboard item not found or not owned by user")
+	}
+
+	// 项目删除后其分享链接一并失效
+	if err := tx.Where("item_id = ?", id).Delete(&Share{}).Error; err != nil {
+		return nil, err
+	}
+
+	seq, err := nextClipboardSeq(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tombstone := &ClipboardTombstone{
+		UserID:    userID,
+		Seq:       seq,
+		ItemID:    id,
+		DeletedAt: time.Now(),
+	}
+	if err := tx.Create(tombstone).Error; err != nil {
+		return nil, err
 	}
 
+	return tombstone, nil
+}
+
+// StorageUsage 用户的存储用量
+type StorageUsage struct {
+	UserID    uint  `json:"user_id"`
+	ItemCount int64 `json:"item_count"`
+	Bytes     int64 `json:"bytes"`
+}
+
+// GetStorageUsage 按用户统计剪贴板项目数量和占用空间
+func GetStorageUsage() (map[uint]StorageUsage, error) {
+	var rows []StorageUsage
+	result := DB.Model(&ClipboardItem{}).
+		Select("user_id, COUNT(*) AS item_count, COALESCE(SUM(size), 0) AS bytes").
+		Group("user_id").
+		Scan(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	usage := make(map[uint]StorageUsage, len(rows))
+	for _, row := range rows {
+		usage[row.UserID] = row
+	}
+	return usage, nil
+}
+
+// GetUserStorageUsage 统计单个用户的剪贴板项目数量和占用空间
+func GetUserStorageUsage(userID uint) (*StorageUsage, error) {
+	return userStorageUsage(DB, userID)
+}
+
+func userStorageUsage(tx *gorm.DB, userID uint) (*StorageUsage, error) {
+	var usage StorageUsage
+	result := tx.Model(&ClipboardItem{}).
+		Select("user_id, COUNT(*) AS item_count, COALESCE(SUM(size), 0) AS bytes").
+		Where("user_id = ?", userID).
+		Scan(&usage)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	usage.UserID = userID
+	return &usage, nil
+}
+
+// 为旧数据补充项目大小：文本按内容长度计算，文件读取存储后端中的实际大小
+func backfillClipboardItemSize() error {
+	if err := DB.Model(&ClipboardItem{}).
+		Where("size = 0 AND type = ?", TypeText).
+		UpdateColumn("size", gorm.Expr("LENGTH(CAST(content AS BLOB))")).Error; err != nil {
+		return err
+	}
+
+	var items []ClipboardItem
+	if err := DB.Select("id, file_path").
+		Where("size = 0 AND file_path <> ''").
+		Find(&items).Error; err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		info, err := storage.Default.Stat(context.Background(), item.FilePath)
+		if err != nil || info.Size == 0 {
+			continue
+		}
+		if err := DB.Model(&ClipboardItem{}).Where("id = ?", item.ID).
+			UpdateColumn("size", info.Size).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 升级前的项目保存的是上传目录中的文件路径，转换为本地存储后端的键
+func backfillStorageKeys() error {
+	var items []ClipboardItem
+	if err := DB.Select("id, file_path").Where("file_path LIKE ?", "%/%").Find(&items).Error; err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err := DB.Model(&ClipboardItem{}).Where("id = ?", item.ID).
+			UpdateColumn("file_path", filepath.Base(item.FilePath)).Error; err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -0,0 +1,54 @@
+package models
+
+import "testing"
+
+func TestTrimClipboardHistoryKeepsNewestAfterPinToggle(t *testing.T) {
+	setupTestDB(t)
+
+	user, err := CreateUser("alice", "secret1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit := 2
+	if err := UpdateUserSettings(user.ID, nil, &limit); err != nil {
+		t.Fatal(err)
+	}
+
+	first, _, err := CreateTextItem(user.ID, "", "first", ItemOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := CreateTextItem(user.ID, "", "second", ItemOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 置顶再取消置顶会让最早的项目获得最新的变更序号
+	if _, err := SetClipboardItemPinned(first.ID, user.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SetClipboardItemPinned(first.ID, user.ID, false); err != nil {
+		t.Fatal(err)
+	}
+
+	_, trimmed, err := CreateTextItem(user.ID, "", "third", ItemOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trimmed) != 1 || trimmed[0].ItemID != first.ID {
+		t.Fatalf("trimmed %v, want only the first item %s", trimmed, first.ID)
+	}
+
+	items, err := GetClipboardItemsByUserID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range items {
+		if item.ID == first.ID {
+			t.Errorf("the oldest item was kept")
+		}
+	}
+	if len(items) != 2 {
+		t.Errorf("got %d items, want 2 (second %s and third)", len(items), second.ID)
+	}
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 最近在线时间的更新间隔，避免每次请求都写数据库
+const deviceTouchInterval = time.Minute
+
+// Device 设备模型，每个会话或个人访问令牌归属于一个设备
+type Device struct {
+	ID         string    `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	UserID     uint      `gorm:"index;not null" json:"user_id"`
+	Name       string    `gorm:"size:100;not null" json:"name"`
+	UserAgent  string    `gorm:"size:255" json:"user_agent"`
+	LastIP     string    `gorm:"size:64" json:"last_ip"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// BeforeCreate 创建前的钩子，用于生成UUID
+func (d *Device) BeforeCreate(tx *gorm.DB) error {
+	d.ID = uuid.New().String()
+	return nil
+}
+
+// CreateDevice 创建设备
+func CreateDevice(userID uint, name, userAgent, ipAddress string) (*Device, error) {
+	if name == "" {
+		name = "Unknown device"
+	}
+
+	device := Device{
+		UserID:     userID,
+		Name:       truncate(name, 100),
+		UserAgent:  truncate(userAgent, 255),
+		LastIP:     truncate(ipAddress, 64),
+		LastSeenAt: time.Now(),
+	}
+
+	result := DB.Create(&device)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &device, nil
+}
+
+// GetDevicesByUserID 获取用户的所有设备
+func GetDevicesByUserID(userID uint) ([]Device, error) {
+	var devices []Device
+	result := DB.Where("user_id = ?", userID).Order("last_seen_at DESC").Find(&devices)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return devices, nil
+}
+
+// FindDeviceByID 通过ID查找用户的设备
+func FindDeviceByID(id string, userID uint) (*Device, error) {
+	var device Device
+	result := DB.Where("id = ? AND user_id = ?", id, userID).First(&device)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errors.New("device not found")
+		}
+		return nil, result.Error
+	}
+	return &device, nil
+}
+
+// TouchDevice 更新设备的最近在线时间和IP
+func TouchDevice(device *Device, ipAddress string) error {
+	now := time.Now()
+	if now.Sub(device.LastSeenAt) < deviceTouchInterval && device.LastIP == ipAddress {
+		return nil
+	}
+
+	result := DB.Model(device).UpdateColumns(map[string]interface{}{
+		"last_seen_at": now,
+		"last_ip":      truncate(ipAddress, 64),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	device.LastSeenAt = now
+	device.LastIP = ipAddress
+	return nil
+}
+
+// RenameDevice 修改设备名称
+func RenameDevice(id string, userID uint, name string) (*Device, error) {
+	device, err := FindDeviceByID(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := DB.Model(device).Update("name", truncate(name, 100))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return device, nil
+}
+
+// DeleteDevice 删除设备，同时撤销其会话并删除其个人访问令牌
+func DeleteDevice(id string, userID uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", id, userID).Delete(&Device{})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return errors.New("device not found or not owned by user")
+		}
+
+		result = tx.Model(&Session{}).
+			Where("device_id = ? AND revoked_at IS NULL", id).
+			Update("revoked_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+
+		return tx.Where("device_id = ?", id).Delete(&APIToken{}).Error
+	})
+}
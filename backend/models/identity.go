@@ -0,0 +1,93 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserIdentity 外部身份提供方账户与本地用户的关联，以签发方和subject唯一确定
+type UserIdentity struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index;not null" json:"user_id"`
+	Issuer    string    `gorm:"size:255;not null;uniqueIndex:idx_identity_subject" json:"issuer"`
+	Subject   string    `gorm:"size:255;not null;uniqueIndex:idx_identity_subject" json:"subject"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FindUserByIdentity 通过外部身份查找已关联的用户
+func FindUserByIdentity(issuer, subject string) (*User, error) {
+	var identity UserIdentity
+	result := DB.Where("issuer = ? AND subject = ?", issuer, subject).First(&identity)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errors.New("identity not linked")
+		}
+		return nil, result.Error
+	}
+
+	return FindUserByID(identity.UserID)
+}
+
+// GetUserIdentities 获取用户关联的全部外部身份
+func GetUserIdentities(userID uint) ([]UserIdentity, error) {
+	var identities []UserIdentity
+	err := DB.Where("user_id = ?", userID).Order("id ASC").Find(&identities).Error
+	return identities, err
+}
+
+// LinkIdentity 将外部身份关联到已有用户，该身份已关联其他用户时返回错误
+func LinkIdentity(userID uint, issuer, subject string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var existing UserIdentity
+		result := tx.Where("issuer = ? AND subject = ?", issuer, subject).First(&existing)
+		if result.Error == nil {
+			if existing.UserID != userID {
+				return errors.New("identity is already linked to another user")
+			}
+			return nil
+		}
+		if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return result.Error
+		}
+
+		return tx.Create(&UserIdentity{UserID: userID, Issuer: issuer, Subject: subject}).Error
+	})
+}
+
+// ProvisionIdentityUser 为首次登录的外部身份创建用户并建立关联
+// 用户名已被占用时改用由身份派生的用户名，不会关联到同名的已有用户
+// 外部用户的密码由身份提供方管理，不设置本地密码
+func ProvisionIdentityUser(issuer, subject, username string) (*User, error) {
+	sum := sha256.Sum256([]byte(issuer + "\x00" + subject))
+	fallback := "sso-" + hex.EncodeToString(sum[:])[:12]
+	if len(username) < 3 || len(username) > 50 {
+		username = fallback
+	}
+
+	var user *User
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			username = fallback
+		}
+
+		user = &User{Username: username}
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&UserIdentity{UserID: user.ID, Issuer: issuer, Subject: subject}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
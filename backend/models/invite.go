@@ -0,0 +1,181 @@
+package models
+
+import (
+	"crypto/rand"
+	"errors"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// InviteCodeLength 邀请码长度，字符集与配对码相同
+const InviteCodeLength = 12
+
+// 初始邀请码的备注
+const bootstrapInviteNote = "bootstrap"
+
+// ErrInvalidInvite 邀请码不存在、已过期、已撤销或已用完
+var ErrInvalidInvite = errors.New("invalid or expired invite code")
+
+// Invite 注册邀请码，仅保存哈希值
+type Invite struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	CodeHash  string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	CreatedBy uint       `gorm:"index" json:"created_by"`
+	Note      string     `gorm:"size:255" json:"note"`
+	Role      string     `gorm:"size:20;not null;default:user" json:"role"` // 注册用户获得的角色
+	MaxUses   int        `gorm:"not null;default:1" json:"max_uses"`        // 0表示不限次数
+	Uses      int        `gorm:"not null;default:0" json:"uses"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// CreateInvite 创建邀请码，返回记录和明文邀请码
+func CreateInvite(createdBy uint, note, role string, maxUses int, expiresAt *time.Time) (*Invite, string, error) {
+	code, err := randomInviteCode()
+	if err != nil {
+		return nil, "", err
+	}
+
+	invite := Invite{
+		CodeHash:  hashToken(code),
+		CreatedBy: createdBy,
+		Note:      truncate(note, 255),
+		Role:      role,
+		MaxUses:   maxUses,
+		ExpiresAt: expiresAt,
+	}
+
+	result := DB.Create(&invite)
+	if result.Error != nil {
+		return nil, "", result.Error
+	}
+
+	return &invite, code, nil
+}
+
+// GetInvites 获取全部邀请码
+func GetInvites() ([]Invite, error) {
+	var invites []Invite
+	result := DB.Order("created_at desc").Find(&invites)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return invites, nil
+}
+
+// RevokeInvite 撤销邀请码，已注册的用户不受影响
+func RevokeInvite(id uint) error {
+	result := DB.Model(&Invite{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("invite not found")
+	}
+
+	return nil
+}
+
+// CreateUserWithInvite 使用邀请码注册用户，邀请码的使用次数与用户创建在同一事务中完成
+func CreateUserWithInvite(username, password, code string) (*User, error) {
+	hash := hashToken(NormalizeInviteCode(code))
+
+	var user *User
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var invite Invite
+		result := tx.Where("code_hash = ?", hash).First(&invite)
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return ErrInvalidInvite
+			}
+			return result.Error
+		}
+
+		if invite.RevokedAt != nil || (invite.ExpiresAt != nil && time.Now().After(*invite.ExpiresAt)) {
+			return ErrInvalidInvite
+		}
+
+		// 以剩余次数作为条件递增，保证并发注册不会超出次数
+		result = tx.Model(&Invite{}).
+			Where("id = ? AND (max_uses = 0 OR uses < max_uses)", invite.ID).
+			UpdateColumn("uses", gorm.Expr("uses + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidInvite
+		}
+
+		user = &User{
+			Username: username,
+			Password: password,
+			InviteID: &invite.ID,
+			Role:     invite.Role,
+		}
+		return tx.Create(user).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// NormalizeInviteCode 规范化用户输入的邀请码：忽略大小写、空格和连字符
+func NormalizeInviteCode(code string) string {
+	return NormalizePairingCode(strings.TrimSpace(code))
+}
+
+// FormatInviteCode 以连字符每四位分段便于抄写
+func FormatInviteCode(code string) string {
+	var parts []string
+	for len(code) > 4 {
+		parts = append(parts, code[:4])
+		code = code[4:]
+	}
+	return strings.Join(append(parts, code), "-")
+}
+
+// 没有任何用户且未开放注册时，生成一次性的初始邀请码并输出到日志，用于注册第一个管理员账户
+// 每次启动都会撤销上一次生成的初始邀请码
+func ensureBootstrapInvite() error {
+	count, err := CountUsers()
+	if err != nil || count > 0 {
+		return err
+	}
+
+	now := time.Now()
+	if err := DB.Model(&Invite{}).
+		Where("created_by = 0 AND note = ? AND revoked_at IS NULL", bootstrapInviteNote).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+
+	expiresAt := now.Add(24 * time.Hour)
+	_, code, err := CreateInvite(0, bootstrapInviteNote, RoleAdmin, 1, &expiresAt)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("No users exist yet. Register the first administrator account within 24 hours using invite code: %s", FormatInviteCode(code))
+	return nil
+}
+
+func randomInviteCode() (string, error) {
+	max := big.NewInt(int64(len(pairingCodeAlphabet)))
+	code := make([]byte, InviteCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = pairingCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
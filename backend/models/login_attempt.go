@@ -0,0 +1,112 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 登录失败计数的统计维度
+const (
+	LoginAttemptUsername = "username"
+	LoginAttemptIP       = "ip"
+)
+
+// 超过免费尝试次数后的首次锁定时长，此后每次失败翻倍
+const loginBackoffBase = 5 * time.Second
+
+// 最后一次失败超过该时间后失败计数清零
+const loginAttemptDecay = 24 * time.Hour
+
+// LoginAttempt 按用户名或IP统计的连续登录失败记录
+type LoginAttempt struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	Kind          string    `gorm:"size:10;not null;uniqueIndex:idx_login_attempt" json:"kind"`
+	Identifier    string    `gorm:"size:100;not null;uniqueIndex:idx_login_attempt" json:"identifier"`
+	Failures      int       `gorm:"not null;default:0" json:"failures"`
+	LastFailureAt time.Time `json:"last_failure_at"`
+	LockedUntil   time.Time `json:"locked_until"`
+}
+
+// LoginLockoutRemaining 返回指定用户名或IP仍需等待的时间，未锁定时返回0
+func LoginLockoutRemaining(kind, identifier string) (time.Duration, error) {
+	var attempt LoginAttempt
+	result := DB.Where("kind = ? AND identifier = ?", kind, truncate(identifier, 100)).First(&attempt)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, result.Error
+	}
+
+	remaining := time.Until(attempt.LockedUntil)
+	if remaining < 0 {
+		return 0, nil
+	}
+	return remaining, nil
+}
+
+// RecordLoginFailure 记录一次登录失败，超过免费尝试次数后按指数退避锁定，锁定时长不超过maxLockout
+func RecordLoginFailure(kind, identifier string, freeAttempts int, maxLockout time.Duration) error {
+	identifier = truncate(identifier, 100)
+	now := time.Now()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var attempt LoginAttempt
+		result := tx.Where("kind = ? AND identifier = ?", kind, identifier).First(&attempt)
+		if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return result.Error
+		}
+
+		if attempt.ID == 0 {
+			attempt = LoginAttempt{Kind: kind, Identifier: identifier}
+		} else if now.Sub(attempt.LastFailureAt) > loginAttemptDecay {
+			attempt.Failures = 0
+		}
+
+		attempt.Failures++
+		attempt.LastFailureAt = now
+		if excess := attempt.Failures - freeAttempts; excess > 0 {
+			lockout := maxLockout
+			// 避免移位溢出
+			if excess < 32 {
+				if backoff := loginBackoffBase << (excess - 1); backoff < maxLockout {
+					lockout = backoff
+				}
+			}
+			attempt.LockedUntil = now.Add(lockout)
+		}
+
+		return tx.Save(&attempt).Error
+	})
+}
+
+// ClearLoginFailures 登录成功后清除失败记录
+func ClearLoginFailures(kind, identifier string) error {
+	return DB.Where("kind = ? AND identifier = ?", kind, truncate(identifier, 100)).Delete(&LoginAttempt{}).Error
+}
+
+// GetLoginLockouts 获取当前处于锁定状态的记录
+func GetLoginLockouts() ([]LoginAttempt, error) {
+	var attempts []LoginAttempt
+	result := DB.Where("locked_until > ?", time.Now()).Order("locked_until desc").Find(&attempts)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return attempts, nil
+}
+
+// DeleteLoginAttempt 解除锁定并清零失败计数
+func DeleteLoginAttempt(id uint) error {
+	result := DB.Delete(&LoginAttempt{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("lockout not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 配对码字符集，去除了容易混淆的0/O、1/I/L
+const pairingCodeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+// PairingCodeLength 配对码长度
+const PairingCodeLength = 8
+
+// PairingCode 一次性设备配对码，仅保存哈希值
+type PairingCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	CodeHash  string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	Scopes    Scopes     `gorm:"type:varchar(255);not null" json:"scopes"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// CreatePairingCode 创建配对码，返回记录和明文配对码
+func CreatePairingCode(userID uint, scopes Scopes, ttl time.Duration) (*PairingCode, string, error) {
+	code, err := randomPairingCode()
+	if err != nil {
+		return nil, "", err
+	}
+
+	pairing := PairingCode{
+		UserID:    userID,
+		CodeHash:  hashToken(code),
+		Scopes:    scopes,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+
+	result := DB.Create(&pairing)
+	if result.Error != nil {
+		return nil, "", result.Error
+	}
+
+	return &pairing, code, nil
+}
+
+// RedeemPairingCode 兑换配对码，为新设备登记设备并签发绑定该设备的个人访问令牌
+func RedeemPairingCode(code, deviceName, userAgent, ipAddress string) (*Device, string, error) {
+	hash := hashToken(NormalizePairingCode(code))
+
+	var device *Device
+	var plaintext string
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var pairing PairingCode
+		result := tx.Where("code_hash = ?", hash).First(&pairing)
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return errors.New("invalid or expired pairing code")
+			}
+			return result.Error
+		}
+
+		if pairing.UsedAt != nil || time.Now().After(pairing.ExpiresAt) {
+			return errors.New("invalid or expired pairing code")
+		}
+
+		// 以未使用作为条件标记，保证配对码只能兑换一次
+		result = tx.Model(&PairingCode{}).
+			Where("id = ? AND used_at IS NULL", pairing.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("invalid or expired pairing code")
+		}
+
+		if deviceName == "" {
+			deviceName = "Paired device"
+		}
+		device = &Device{
+			UserID:     pairing.UserID,
+			Name:       truncate(deviceName, 100),
+			UserAgent:  truncate(userAgent, 255),
+			LastIP:     truncate(ipAddress, 64),
+			LastSeenAt: time.Now(),
+		}
+		if err := tx.Create(device).Error; err != nil {
+			return err
+		}
+
+		token, secret, err := newAPIToken(pairing.UserID, device.ID, device.Name, pairing.Scopes, nil)
+		if err != nil {
+			return err
+		}
+		plaintext = secret
+		return tx.Create(token).Error
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return device, plaintext, nil
+}
+
+// NormalizePairingCode 规范化用户输入的配对码：忽略大小写、空格和连字符
+func NormalizePairingCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.ReplaceAll(code, "-", "")
+	code = strings.ReplaceAll(code, " ", "")
+	return code
+}
+
+func randomPairingCode() (string, error) {
+	max := big.NewInt(int64(len(pairingCodeAlphabet)))
+	code := make([]byte, PairingCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = pairingCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
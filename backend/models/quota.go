@@ -0,0 +1,78 @@
+package models
+
+import (
+	"errors"
+
+	"github.com/weicopy/backend/config"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrStorageQuotaExceeded 保存后将超出用户的存储空间配额
+	ErrStorageQuotaExceeded = errors.New("storage quota exceeded")
+	// ErrItemQuotaExceeded 保存后将超出用户的项目数配额
+	ErrItemQuotaExceeded = errors.New("item quota exceeded")
+)
+
+// Quota 用户生效的配额，0表示不限
+type Quota struct {
+	MaxBytes int64 `json:"max_bytes"`
+	MaxItems int   `json:"max_items"`
+}
+
+// GetUserQuota 获取用户生效的配额：管理员设置优先，未设置时使用服务端配置
+func GetUserQuota(user *User) Quota {
+	quota := Quota{
+		MaxBytes: config.GetDefaultStorageQuota(),
+		MaxItems: config.GetDefaultItemQuota(),
+	}
+	if user.StorageQuotaMB != nil {
+		quota.MaxBytes = int64(*user.StorageQuotaMB) * 1024 * 1024
+	}
+	if user.ItemQuota != nil {
+		quota.MaxItems = *user.ItemQuota
+	}
+	return quota
+}
+
+// UpdateUserQuota 设置用户的配额，值为空时使用服务端配置
+func UpdateUserQuota(id uint, storageQuotaMB, itemQuota *int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := updateUserColumn(tx, id, "storage_quota_mb", storageQuotaMB); err != nil {
+			return err
+		}
+		return updateUserColumn(tx, id, "item_quota", itemQuota)
+	})
+}
+
+// CheckStorageQuota 检查再保存size字节和一个项目后是否超出配额，用于在写入上传文件前提前拒绝
+// 创建项目时会在事务中再次检查
+func CheckStorageQuota(userID uint, size int64) error {
+	return checkQuota(DB, userID, 1, size)
+}
+
+// 检查用户现有项目再增加items个、bytes字节后是否超出配额
+func checkQuota(tx *gorm.DB, userID uint, items int, bytes int64) error {
+	var user User
+	if err := tx.Select("storage_quota_mb", "item_quota").First(&user, userID).Error; err != nil {
+		return err
+	}
+
+	quota := GetUserQuota(&user)
+	if quota.MaxBytes <= 0 && quota.MaxItems <= 0 {
+		return nil
+	}
+
+	usage, err := userStorageUsage(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	if quota.MaxItems > 0 && usage.ItemCount+int64(items) > int64(quota.MaxItems) {
+		return ErrItemQuotaExceeded
+	}
+	if quota.MaxBytes > 0 && usage.Bytes+bytes > quota.MaxBytes {
+		return ErrStorageQuotaExceeded
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 令牌权限范围
+const (
+	ScopeClipboardRead   = "clipboard:read"
+	ScopeClipboardWrite  = "clipboard:write"
+	ScopeClipboardDelete = "clipboard:delete"
+	ScopeAccountAdmin    = "account:admin"
+)
+
+// AllScopes 所有权限范围，登录获得的JWT拥有全部权限
+var AllScopes = Scopes{ScopeClipboardRead, ScopeClipboardWrite, ScopeClipboardDelete, ScopeAccountAdmin}
+
+// DefaultTokenScopes 创建个人访问令牌时未指定权限范围的默认值
+var DefaultTokenScopes = Scopes{ScopeClipboardRead, ScopeClipboardWrite, ScopeClipboardDelete}
+
+// Scopes 权限范围列表，在数据库中以空格分隔的字符串保存
+type Scopes []string
+
+// ParseScopes 校验并规范化权限范围列表
+func ParseScopes(scopes []string) (Scopes, error) {
+	result := Scopes{}
+	for _, scope := range scopes {
+		if !AllScopes.Has(scope) {
+			return nil, fmt.Errorf("unknown scope: %s", scope)
+		}
+		if !result.Has(scope) {
+			result = append(result, scope)
+		}
+	}
+	return result, nil
+}
+
+// Has 是否包含指定权限范围
+func (s Scopes) Has(scope string) bool {
+	for _, item := range s {
+		if item == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains 是否包含另一组权限范围的全部权限
+func (s Scopes) Contains(other Scopes) bool {
+	for _, scope := range other {
+		if !s.Has(scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// Value 实现driver.Valuer接口
+func (s Scopes) Value() (driver.Value, error) {
+	return strings.Join(s, " "), nil
+}
+
+// Scan 实现sql.Scanner接口
+func (s *Scopes) Scan(value interface{}) error {
+	var str string
+	switch v := value.(type) {
+	case string:
+		str = v
+	case []byte:
+		str = string(v)
+	case nil:
+		str = ""
+	default:
+		return errors.New("invalid scopes value")
+	}
+
+	*s = Scopes(strings.Fields(str))
+	return nil
+}
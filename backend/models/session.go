@@ -0,0 +1,158 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Session 登录会话模型，保存轮换使用的刷新令牌哈希
+type Session struct {
+	ID               string `gorm:"primaryKey;type:varchar(36)" json:"id"`
+	UserID           uint   `gorm:"index;not null" json:"user_id"`
+	DeviceID         string `gorm:"type:varchar(36);index" json:"device_id"`
+	RefreshTokenHash string `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	// 上一个刷新令牌的哈希，用于检测已轮换的刷新令牌被重复使用
+	PreviousTokenHash string     `gorm:"size:64;index" json:"-"`
+	UserAgent         string     `gorm:"size:255" json:"user_agent"`
+	IPAddress         string     `gorm:"size:64" json:"ip_address"`
+	ExpiresAt         time.Time  `json:"expires_at"`
+	LastUsedAt        time.Time  `json:"last_used_at"`
+	RevokedAt         *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// BeforeCreate 创建前的钩子，用于生成UUID
+func (s *Session) BeforeCreate(tx *gorm.DB) error {
+	s.ID = uuid.New().String()
+	return nil
+}
+
+// IsActive 会话是否未撤销且未过期
+func (s *Session) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// CreateSession 创建登录会话，返回会话和明文刷新令牌
+func CreateSession(userID uint, deviceID, userAgent, ipAddress string, ttl time.Duration) (*Session, string, error) {
+	refreshToken, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	session := Session{
+		UserID:           userID,
+		DeviceID:         deviceID,
+		RefreshTokenHash: hashToken(refreshToken),
+		UserAgent:        truncate(userAgent, 255),
+		IPAddress:        truncate(ipAddress, 64),
+		ExpiresAt:        now.Add(ttl),
+		LastUsedAt:       now,
+	}
+
+	result := DB.Create(&session)
+	if result.Error != nil {
+		return nil, "", result.Error
+	}
+
+	return &session, refreshToken, nil
+}
+
+// RotateSession 使用刷新令牌换取新的刷新令牌并延长会话有效期
+// 已轮换过的刷新令牌再次出现时视为泄露，立即撤销整个会话
+func RotateSession(refreshToken string, ttl time.Duration) (*Session, string, error) {
+	hash := hashToken(refreshToken)
+
+	var session Session
+	result := DB.Where("refresh_token_hash = ?", hash).First(&session)
+	if result.Error != nil {
+		if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, "", result.Error
+		}
+
+		// 检测刷新令牌重放
+		var reused Session
+		if err := DB.Where("previous_token_hash = ?", hash).First(&reused).Error; err == nil {
+			RevokeSession(reused.ID, reused.UserID)
+			return nil, "", errors.New("refresh token reuse detected")
+		}
+		return nil, "", errors.New("invalid refresh token")
+	}
+
+	if !session.IsActive() {
+		return nil, "", errors.New("session expired or revoked")
+	}
+
+	newToken, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	// 以旧哈希作为条件更新，防止并发刷新时同一令牌被使用两次
+	result = DB.Model(&Session{}).
+		Where("id = ? AND refresh_token_hash = ?", session.ID, hash).
+		Updates(map[string]interface{}{
+			"refresh_token_hash":  hashToken(newToken),
+			"previous_token_hash": hash,
+			"expires_at":          now.Add(ttl),
+			"last_used_at":        now,
+		})
+	if result.Error != nil {
+		return nil, "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, "", errors.New("invalid refresh token")
+	}
+
+	session.ExpiresAt = now.Add(ttl)
+	session.LastUsedAt = now
+	return &session, newToken, nil
+}
+
+// FindSessionByID 通过ID查找会话
+func FindSessionByID(id string) (*Session, error) {
+	var session Session
+	result := DB.Where("id = ?", id).First(&session)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errors.New("session not found")
+		}
+		return nil, result.Error
+	}
+	return &session, nil
+}
+
+// RevokeSession 撤销用户的某个会话
+func RevokeSession(id string, userID uint) error {
+	result := DB.Model(&Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("session not found or already revoked")
+	}
+
+	return nil
+}
+
+// RevokeAllSessions 撤销用户的全部会话
+func RevokeAllSessions(userID uint) error {
+	result := DB.Model(&Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now())
+	return result.Error
+}
+
+func truncate(str string, max int) string {
+	if len(str) > max {
+		return str[:max]
+	}
+	return str
+}
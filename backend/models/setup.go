@@ -1,11 +1,13 @@
 package models
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 
 	"github.com/weicopy/backend/config"
+	"github.com/weicopy/backend/storage"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -13,36 +15,78 @@ import (
 
 var DB *gorm.DB
 
-// ConnectDatabase 初始化数据库连接
+// ConnectDatabase 初始化数据库连接并完成迁移，供服务端启动时使用
 func ConnectDatabase() {
+	if err := OpenDatabase(logger.Info); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	if err := Migrate(); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	// 未开放注册时为空数据库生成初始邀请码
+	if !config.IsRegistrationEnabled() {
+		if err := ensureBootstrapInvite(); err != nil {
+			log.Fatalf("Failed to create bootstrap invite: %v", err)
+		}
+	}
+
+	log.Println("Database connected and migrated successfully")
+}
+
+// OpenDatabase 创建数据库目录、初始化文件存储并打开数据库连接，logLevel控制SQL日志的输出级别
+func OpenDatabase(logLevel logger.LogLevel) error {
 	// 确保数据库目录存在
 	dbPath := config.GetDBPath()
 	dbDir := filepath.Dir(dbPath)
 	if err := os.MkdirAll(dbDir, 0755); err != nil {
-		log.Fatalf("Failed to create database directory: %v", err)
+		return fmt.Errorf("create database directory: %w", err)
 	}
 
-	// 确保上传目录存在
-	uploadPath := config.GetUploadPath()
-	if err := os.MkdirAll(uploadPath, 0755); err != nil {
-		log.Fatalf("Failed to create upload directory: %v", err)
+	// 初始化文件存储，本地存储时创建上传目录
+	if err := storage.Setup(); err != nil {
+		return fmt.Errorf("set up file storage: %w", err)
 	}
 
 	// 配置数据库
 	database, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+		Logger: logger.Default.LogMode(logLevel),
 	})
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		return err
 	}
 
 	// 设置全局变量
 	DB = database
+	return nil
+}
 
-	// 自动迁移数据库模型
-	if err := DB.AutoMigrate(&User{}, &ClipboardItem{}); err != nil {
-		log.Fatalf("Failed to migrate database: %v", err)
+// Migrate 自动迁移数据库模型并补充旧数据
+func Migrate() error {
+	if err := DB.AutoMigrate(&User{}, &ClipboardItem{}, &ClipboardTombstone{}, &APIToken{}, &Session{}, &Device{}, &PairingCode{}, &RecoveryCode{}, &UserIdentity{}, &WebAuthnCredential{}, &WebAuthnChallenge{}, &LoginAttempt{}, &Invite{}, &Share{}); err != nil {
+		return err
 	}
 
-	log.Println("Database connected and migrated successfully")
+	// 为旧数据补充变更序号
+	if err := backfillClipboardSeq(); err != nil {
+		return fmt.Errorf("backfill clipboard sequence numbers: %w", err)
+	}
+
+	// 将旧数据的文件路径转换为存储键
+	if err := backfillStorageKeys(); err != nil {
+		return fmt.Errorf("backfill storage keys: %w", err)
+	}
+
+	// 为旧数据补充项目大小
+	if err := backfillClipboardItemSize(); err != nil {
+		return fmt.Errorf("backfill clipboard item sizes: %w", err)
+	}
+
+	// 将ADMIN_USERNAMES中的用户设为管理员
+	if err := promoteAdmins(config.GetAdminUsernames()); err != nil {
+		return fmt.Errorf("promote administrators: %w", err)
+	}
+
+	return nil
 }
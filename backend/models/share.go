@@ -0,0 +1,138 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ErrShareUnavailable 分享链接不存在、已撤销、已过期或查看次数已用完
+var ErrShareUnavailable = errors.New("share not found or no longer available")
+
+// Share 剪贴板项目的公开分享链接，仅保存令牌哈希
+type Share struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	UserID       uint       `gorm:"index;not null" json:"-"`
+	ItemID       string     `gorm:"type:varchar(36);index;not null" json:"item_id"`
+	TokenHash    string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	PasswordHash string     `gorm:"size:100" json:"-"` // 为空表示无需密码
+	HasPassword  bool       `gorm:"-" json:"has_password"`
+	MaxViews     int        `gorm:"not null;default:0" json:"max_views"` // 0表示不限次数
+	Views        int        `gorm:"not null;default:0" json:"views"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	LastViewedAt *time.Time `json:"last_viewed_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// AfterFind 查询后的钩子，标记是否设置了密码
+func (s *Share) AfterFind(tx *gorm.DB) error {
+	s.HasPassword = s.PasswordHash != ""
+	return nil
+}
+
+// CheckPassword 检查访问密码，未设置密码时总是通过
+func (s *Share) CheckPassword(password string) bool {
+	if s.PasswordHash == "" {
+		return true
+	}
+	return bcrypt.CompareHashAndPassword([]byte(s.PasswordHash), []byte(password)) == nil
+}
+
+// CreateShare 为剪贴板项目创建分享链接，返回记录和明文令牌
+func CreateShare(userID uint, itemID, password string, maxViews int, expiresAt *time.Time) (*Share, string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	share := Share{
+		UserID:      userID,
+		ItemID:      itemID,
+		TokenHash:   hashToken(token),
+		HasPassword: password != "",
+		MaxViews:    maxViews,
+		ExpiresAt:   expiresAt,
+	}
+
+	if password != "" {
+		share.PasswordHash, err = hashPassword(password)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	result := DB.Create(&share)
+	if result.Error != nil {
+		return nil, "", result.Error
+	}
+
+	return &share, token, nil
+}
+
+// GetSharesByUserID 获取用户创建的全部分享链接
+func GetSharesByUserID(userID uint) ([]Share, error) {
+	var shares []Share
+	result := DB.Where("user_id = ?", userID).Order("created_at desc").Find(&shares)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return shares, nil
+}
+
+// FindShareByToken 通过明文令牌查找仍然有效的分享链接
+func FindShareByToken(token string) (*Share, error) {
+	var share Share
+	result := DB.Where("token_hash = ?", hashToken(token)).First(&share)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrShareUnavailable
+		}
+		return nil, result.Error
+	}
+
+	if share.RevokedAt != nil ||
+		(share.ExpiresAt != nil && time.Now().After(*share.ExpiresAt)) ||
+		(share.MaxViews > 0 && share.Views >= share.MaxViews) {
+		return nil, ErrShareUnavailable
+	}
+
+	return &share, nil
+}
+
+// ConsumeShareView 记录一次查看，以剩余次数作为条件递增，保证并发访问不会超出次数
+func ConsumeShareView(id uint) error {
+	result := DB.Model(&Share{}).
+		Where("id = ? AND revoked_at IS NULL AND (max_views = 0 OR views < max_views)", id).
+		UpdateColumns(map[string]interface{}{
+			"views":          gorm.Expr("views + 1"),
+			"last_viewed_at": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrShareUnavailable
+	}
+
+	return nil
+}
+
+// RevokeShare 撤销分享链接
+func RevokeShare(id, userID uint) error {
+	result := DB.Model(&Share{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("share not found or already revoked")
+	}
+
+	return nil
+}
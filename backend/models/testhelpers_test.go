@@ -0,0 +1,30 @@
+package models
+
+import (
+	"path/filepath"
+	"testing"
+
+	"gorm.io/gorm/logger"
+)
+
+// 使用临时目录中的数据库和上传目录，供本包的测试共用
+func setupTestDB(t *testing.T) {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Setenv("DB_PATH", filepath.Join(dir, "weicopy.db"))
+	t.Setenv("UPLOAD_PATH", filepath.Join(dir, "uploads"))
+	t.Setenv("STORAGE_BACKEND", "local")
+
+	if err := OpenDatabase(logger.Silent); err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 恢复码数量和格式
+const (
+	recoveryCodeCount    = 10
+	recoveryCodeLength   = 10
+	recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+// RecoveryCode 两步验证恢复码，每个只能使用一次，仅保存哈希值
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"-"`
+	UserID    uint       `gorm:"index;not null" json:"-"`
+	CodeHash  string     `gorm:"size:64;not null" json:"-"`
+	UsedAt    *time.Time `json:"-"`
+	CreatedAt time.Time  `json:"-"`
+}
+
+// SetPendingTOTPSecret 保存待确认的TOTP密钥，确认前不会生效
+func SetPendingTOTPSecret(userID uint, secret string) error {
+	result := DB.Model(&User{}).Where("id = ? AND totp_enabled = ?", userID, false).
+		UpdateColumns(map[string]interface{}{
+			"totp_secret":    secret,
+			"totp_last_step": 0,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("two-factor authentication is already enabled")
+	}
+
+	return nil
+}
+
+// EnableTOTP 确认并启用两步验证，返回新生成的恢复码明文
+func EnableTOTP(userID uint, step int64) ([]string, error) {
+	var codes []string
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ? AND totp_enabled = ?", userID, false).
+			UpdateColumns(map[string]interface{}{
+				"totp_enabled":   true,
+				"totp_last_step": step,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("two-factor authentication is already enabled")
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableTOTP 关闭两步验证并删除恢复码
+func DisableTOTP(userID uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ?", userID).
+			UpdateColumns(map[string]interface{}{
+				"totp_secret":    "",
+				"totp_enabled":   false,
+				"totp_last_step": 0,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		return tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error
+	})
+}
+
+// ConsumeTOTPStep 记录已使用的TOTP步长，步长不大于上次使用的值时视为重放
+func ConsumeTOTPStep(userID uint, step int64) error {
+	result := DB.Model(&User{}).Where("id = ? AND totp_last_step < ?", userID, step).
+		UpdateColumn("totp_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("verification code has already been used")
+	}
+
+	return nil
+}
+
+// ConsumeRecoveryCode 使用一个恢复码
+func ConsumeRecoveryCode(userID uint, code string) error {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+
+	result := DB.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashToken(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("invalid recovery code")
+	}
+
+	return nil
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，旧恢复码全部失效
+func RegenerateRecoveryCodes(userID uint) ([]string, error) {
+	var codes []string
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// CountRecoveryCodes 获取用户剩余可用的恢复码数量
+func CountRecoveryCodes(userID uint) (int64, error) {
+	var count int64
+	result := DB.Model(&RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return count, nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := randomRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, RecoveryCode{UserID: userID, CodeHash: hashToken(code)})
+		// 以连字符分成两段便于抄写，使用时会忽略连字符
+		codes = append(codes, code[:recoveryCodeLength/2]+"-"+code[recoveryCodeLength/2:])
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func randomRecoveryCode() (string, error) {
+	max := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	code := make([]byte, recoveryCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = recoveryCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
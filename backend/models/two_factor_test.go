@@ -0,0 +1,53 @@
+package models
+
+import "testing"
+
+func TestConsumeTOTPStepRejectsReuse(t *testing.T) {
+	setupTestDB(t)
+
+	user, err := CreateUser("alice", "secret1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const step int64 = 41152263
+	if err := ConsumeTOTPStep(user.ID, step); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+
+	// 同一验证码不能再次使用
+	if err := ConsumeTOTPStep(user.ID, step); err == nil {
+		t.Error("reusing the same step succeeded")
+	}
+
+	// 时间窗口内较早的验证码同样视为重放
+	if err := ConsumeTOTPStep(user.ID, step-1); err == nil {
+		t.Error("using an earlier step succeeded")
+	}
+
+	if err := ConsumeTOTPStep(user.ID, step+1); err != nil {
+		t.Errorf("next step: %v", err)
+	}
+}
+
+func TestEnableTOTPConsumesStep(t *testing.T) {
+	setupTestDB(t)
+
+	user, err := CreateUser("alice", "secret1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetPendingTOTPSecret(user.ID, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"); err != nil {
+		t.Fatal(err)
+	}
+
+	const step int64 = 41152263
+	if _, err := EnableTOTP(user.ID, step); err != nil {
+		t.Fatal(err)
+	}
+
+	// 启用时使用的验证码不能再用于登录
+	if err := ConsumeTOTPStep(user.ID, step); err == nil {
+		t.Error("step used to enable TOTP was accepted again")
+	}
+}
@@ -2,34 +2,70 @@ package models
 
 import (
 	"errors"
+	"log"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
+// 用户角色
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 // User 用户模型
 type User struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Username  string    `gorm:"size:100;uniqueIndex;not null" json:"username"`
-	Password  string    `gorm:"size:100;not null" json:"-"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-}
-
-// BeforeSave 保存前的钩子，用于加密密码
-func (u *User) BeforeSave(tx *gorm.DB) error {
-	// 检查密码是否已经加密
-	if len(u.Password) > 0 && len(u.Password) < 60 {
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
-		if err != nil {
-			return err
-		}
-		u.Password = string(hashedPassword)
+	ID       uint   `gorm:"primaryKey" json:"id"`
+	Username string `gorm:"size:100;uniqueIndex;not null" json:"username"`
+	Password string `gorm:"size:100;not null" json:"-"`
+	// 剪贴板变更序号，每次创建或删除项目时递增
+	ClipboardSeq    uint64     `gorm:"not null;default:0" json:"-"`
+	TOTPSecret      string     `gorm:"size:64" json:"-"` // TOTP两步验证密钥，启用前为待确认状态
+	TOTPEnabled     bool       `gorm:"not null;default:false" json:"totp_enabled"`
+	TOTPLastStep    int64      `gorm:"not null;default:0" json:"-"` // 最近一次使用的TOTP步长，用于防止验证码重放
+	InviteID        *uint      `gorm:"index" json:"invite_id"`      // 注册时使用的邀请码
+	Role            string     `gorm:"size:20;not null;default:user" json:"role"`
+	DisabledAt      *time.Time `json:"disabled_at"`       // 被管理员停用的时间，停用后无法登录和访问接口
+	ItemTTLHours    *int       `json:"item_ttl_hours"`    // 新建项目的默认保留小时数，为空时使用服务端配置，0表示永久保留
+	MaxHistoryItems *int       `json:"max_history_items"` // 最多保留的未置顶项目数，为空时使用服务端配置，0表示不限
+	StorageQuotaMB  *int       `json:"storage_quota_mb"`  // 由管理员设置的存储空间配额，为空时使用服务端配置，0表示不限
+	ItemQuota       *int       `json:"item_quota"`        // 由管理员设置的项目数配额，为空时使用服务端配置，0表示不限
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate 创建前的钩子，将明文密码加密后保存
+// 修改已有用户的密码需使用ChangePassword，保存已有记录时不会再次加密
+func (u *User) BeforeCreate(tx *gorm.DB) error {
+	if u.Password == "" {
+		return nil
 	}
+
+	hashedPassword, err := hashPassword(u.Password)
+	if err != nil {
+		return err
+	}
+	u.Password = hashedPassword
 	return nil
 }
 
+// IsAdmin 是否为管理员
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// IsDisabled 是否已被停用
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil
+}
+
+// HasLocalPassword 是否设置了本地密码，通过外部身份创建的用户没有本地密码
+func (u *User) HasLocalPassword() bool {
+	return u.Password != ""
+}
+
 // CheckPassword 检查密码是否正确
 func (u *User) CheckPassword(password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
@@ -63,9 +99,15 @@ func FindUserByID(id uint) (*User, error) {
 
 // CreateUser 创建新用户
 func CreateUser(username, password string) (*User, error) {
+	return CreateUserWithRole(username, password, RoleUser)
+}
+
+// CreateUserWithRole 创建指定角色的新用户
+func CreateUserWithRole(username, password, role string) (*User, error) {
 	user := User{
 		Username: username,
 		Password: password,
+		Role:     role,
 	}
 
 	result := DB.Create(&user)
@@ -75,3 +117,207 @@ func CreateUser(username, password string) (*User, error) {
 
 	return &user, nil
 }
+
+// CountUsers 获取用户总数
+func CountUsers() (int64, error) {
+	var count int64
+	result := DB.Model(&User{}).Count(&count)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return count, nil
+}
+
+// GetUsers 获取全部用户
+func GetUsers() ([]User, error) {
+	var users []User
+	result := DB.Order("id").Find(&users)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return users, nil
+}
+
+// UpdateUserSettings 保存用户的保留设置，值为空时使用服务端配置
+// 新的历史数量上限在下次创建项目时生效
+func UpdateUserSettings(id uint, itemTTLHours, maxHistoryItems *int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := updateUserColumn(tx, id, "item_ttl_hours", itemTTLHours); err != nil {
+			return err
+		}
+		return updateUserColumn(tx, id, "max_history_items", maxHistoryItems)
+	})
+}
+
+// ErrLastAdmin 操作会导致系统中不再有可用的管理员
+var ErrLastAdmin = errors.New("cannot remove the last active administrator")
+
+// UpdateUserRole 修改用户角色，不允许降级最后一个可用的管理员
+func UpdateUserRole(id uint, role string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if role != RoleAdmin {
+			if err := ensureOtherAdmin(tx, id); err != nil {
+				return err
+			}
+		}
+		return updateUserColumn(tx, id, "role", role)
+	})
+}
+
+// SetUserDisabled 停用或启用用户，停用时同时撤销其全部会话
+func SetUserDisabled(id uint, disabled bool) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if !disabled {
+			return updateUserColumn(tx, id, "disabled_at", nil)
+		}
+
+		if err := ensureOtherAdmin(tx, id); err != nil {
+			return err
+		}
+		if err := updateUserColumn(tx, id, "disabled_at", time.Now()); err != nil {
+			return err
+		}
+		return tx.Model(&Session{}).
+			Where("user_id = ? AND revoked_at IS NULL", id).
+			Update("revoked_at", time.Now()).Error
+	})
+}
+
+// ResetUserPassword 重置用户密码并撤销其全部会话
+func ResetUserPassword(id uint, password string) error {
+	return ChangePassword(id, password, "")
+}
+
+// ChangePassword 修改用户密码，并撤销除keepSessionID外的全部会话
+func ChangePassword(id uint, password, keepSessionID string) error {
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := updateUserColumn(tx, id, "password", hashedPassword); err != nil {
+			return err
+		}
+		return tx.Model(&Session{}).
+			Where("user_id = ? AND id <> ? AND revoked_at IS NULL", id, keepSessionID).
+			Update("revoked_at", time.Now()).Error
+	})
+}
+
+// DeleteUser 删除用户及其全部数据，并删除已上传的文件
+func DeleteUser(id uint) error {
+	var fileKeys []string
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var user User
+		if err := tx.First(&user, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("user not found")
+			}
+			return err
+		}
+
+		if err := ensureOtherAdmin(tx, id); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&ClipboardItem{}).
+			Where("user_id = ? AND file_path <> ''", id).
+			Pluck("file_path", &fileKeys).Error; err != nil {
+			return err
+		}
+
+		for _, model := range []interface{}{
+			&ClipboardItem{}, &ClipboardTombstone{}, &APIToken{}, &Session{}, &Device{}, &PairingCode{},
+			&RecoveryCode{}, &UserIdentity{}, &WebAuthnCredential{}, &WebAuthnChallenge{}, &Share{},
+		} {
+			if err := tx.Where("user_id = ?", id).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("kind = ? AND identifier = ?", LoginAttemptUsername, user.Username).
+			Delete(&LoginAttempt{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&User{}, id).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	// 数据库记录删除后再删除文件，失败时只留下孤立文件
+	for _, key := range fileKeys {
+		DeleteStoredFile(key)
+	}
+
+	return nil
+}
+
+// 检查除指定用户外是否还有未停用的管理员；指定用户本身不是可用管理员时直接通过
+func ensureOtherAdmin(tx *gorm.DB, id uint) error {
+	var user User
+	if err := tx.First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("user not found")
+		}
+		return err
+	}
+	if !user.IsAdmin() || user.IsDisabled() {
+		return nil
+	}
+
+	var count int64
+	if err := tx.Model(&User{}).
+		Where("id <> ? AND role = ? AND disabled_at IS NULL", id, RoleAdmin).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrLastAdmin
+	}
+	return nil
+}
+
+// 使用bcrypt加密密码
+func hashPassword(password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashedPassword), nil
+}
+
+// 更新用户的单个字段，不触发保存钩子
+func updateUserColumn(tx *gorm.DB, id uint, column string, value interface{}) error {
+	result := tx.Model(&User{}).Where("id = ?", id).UpdateColumn(column, value)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("user not found")
+	}
+
+	return nil
+}
+
+// 将配置的用户名提升为管理员，用于在已有数据库上指定首个管理员
+func promoteAdmins(usernames []string) error {
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	result := DB.Model(&User{}).
+		Where("username IN ? AND role <> ?", usernames, RoleAdmin).
+		UpdateColumn("role", RoleAdmin)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		log.Printf("Promoted %d user(s) listed in ADMIN_USERNAMES to administrator", result.RowsAffected)
+	}
+	return nil
+}
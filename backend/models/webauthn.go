@@ -0,0 +1,154 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WebAuthn挑战的用途
+const (
+	WebAuthnRegistration = "registration"
+	WebAuthnLogin        = "login"
+)
+
+// WebAuthnCredential 用户注册的通行密钥
+type WebAuthnCredential struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	UserID       uint       `gorm:"index;not null" json:"-"`
+	Name         string     `gorm:"size:100;not null" json:"name"`
+	CredentialID []byte     `gorm:"uniqueIndex;not null" json:"-"`
+	PublicKey    []byte     `gorm:"not null" json:"-"` // COSE格式的公钥
+	SignCount    uint32     `gorm:"not null;default:0" json:"-"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// WebAuthnChallenge 服务端保存的一次性挑战，校验时按挑战值取出并删除
+type WebAuthnChallenge struct {
+	ID            uint      `gorm:"primaryKey"`
+	ChallengeHash string    `gorm:"size:64;uniqueIndex;not null"`
+	UserID        uint      `gorm:"index"` // 登录时为0，由凭据确定用户
+	Purpose       string    `gorm:"size:20;not null"`
+	ExpiresAt     time.Time `gorm:"index"`
+	CreatedAt     time.Time
+}
+
+// CreateWebAuthnChallenge 保存挑战值
+func CreateWebAuthnChallenge(userID uint, purpose string, challenge []byte, ttl time.Duration) error {
+	// 顺带清理过期的挑战
+	DB.Where("expires_at < ?", time.Now()).Delete(&WebAuthnChallenge{})
+
+	return DB.Create(&WebAuthnChallenge{
+		ChallengeHash: hashToken(string(challenge)),
+		UserID:        userID,
+		Purpose:       purpose,
+		ExpiresAt:     time.Now().Add(ttl),
+	}).Error
+}
+
+// ConsumeWebAuthnChallenge 取出并删除挑战，保证每个挑战只能使用一次
+func ConsumeWebAuthnChallenge(purpose string, challenge []byte) (*WebAuthnChallenge, error) {
+	var record WebAuthnChallenge
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("challenge_hash = ? AND purpose = ?", hashToken(string(challenge)), purpose).First(&record)
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return errors.New("invalid or expired challenge")
+			}
+			return result.Error
+		}
+
+		result = tx.Delete(&WebAuthnChallenge{}, record.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("invalid or expired challenge")
+		}
+
+		if time.Now().After(record.ExpiresAt) {
+			return errors.New("invalid or expired challenge")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// CreateWebAuthnCredential 保存新注册的通行密钥
+func CreateWebAuthnCredential(userID uint, name string, credentialID, publicKey []byte, signCount uint32) (*WebAuthnCredential, error) {
+	credential := WebAuthnCredential{
+		UserID:       userID,
+		Name:         truncate(name, 100),
+		CredentialID: credentialID,
+		PublicKey:    publicKey,
+		SignCount:    signCount,
+	}
+
+	result := DB.Create(&credential)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return &credential, nil
+}
+
+// GetWebAuthnCredentialsByUserID 获取用户的全部通行密钥
+func GetWebAuthnCredentialsByUserID(userID uint) ([]WebAuthnCredential, error) {
+	var credentials []WebAuthnCredential
+	result := DB.Where("user_id = ?", userID).Order("created_at desc").Find(&credentials)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return credentials, nil
+}
+
+// FindWebAuthnCredential 通过凭据ID查找通行密钥
+func FindWebAuthnCredential(credentialID []byte) (*WebAuthnCredential, error) {
+	var credential WebAuthnCredential
+	result := DB.Where("credential_id = ?", credentialID).First(&credential)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, errors.New("credential not found")
+		}
+		return nil, result.Error
+	}
+	return &credential, nil
+}
+
+// UpdateWebAuthnSignCount 登录成功后更新签名计数和最近使用时间
+// 以旧计数作为条件，防止并发的重复断言都通过校验
+func UpdateWebAuthnSignCount(id uint, oldCount, newCount uint32) error {
+	result := DB.Model(&WebAuthnCredential{}).
+		Where("id = ? AND sign_count = ?", id, oldCount).
+		UpdateColumns(map[string]interface{}{
+			"sign_count":   newCount,
+			"last_used_at": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("credential was used concurrently")
+	}
+	return nil
+}
+
+// DeleteWebAuthnCredential 删除通行密钥
+func DeleteWebAuthnCredential(id, userID uint) error {
+	result := DB.Where("id = ? AND user_id = ?", id, userID).Delete(&WebAuthnCredential{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.New("credential not found")
+	}
+
+	return nil
+}
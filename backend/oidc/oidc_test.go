@@ -0,0 +1,469 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	testClientID    = "weicopy"
+	testRedirectURL = "https://weicopy.example/api/auth/oidc/callback"
+	testCode        = "auth-code"
+	testVerifier    = "verifier"
+	testNonce       = "nonce"
+)
+
+// 模拟的身份提供方，提供服务发现、JWKS和令牌接口
+type mockIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+
+	// 令牌接口返回的ID令牌
+	idToken string
+	// 发现文档中的issuer，为空时使用服务地址
+	discoveryIssuer string
+
+	jwksRequests int32
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key, kid: "key-1"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer := m.discoveryIssuer
+		if issuer == "" {
+			issuer = m.server.URL
+		}
+		json.NewEncoder(w).Encode(Discovery{
+			Issuer:                issuer,
+			AuthorizationEndpoint: m.server.URL + "/authorize",
+			TokenEndpoint:         m.server.URL + "/token",
+			JWKSURI:               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&m.jwksRequests, 1)
+		json.NewEncoder(w).Encode(jsonWebKeySet{Keys: []jsonWebKey{
+			rsaJWK(m.kid, &m.key.PublicKey),
+			// 加密用途的密钥不能用于校验签名
+			{Kty: "RSA", Kid: "enc-key", Use: "enc", N: "AQAB", E: "AQAB"},
+		}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.PostForm.Get("grant_type") != "authorization_code" ||
+			r.PostForm.Get("code") != testCode ||
+			r.PostForm.Get("code_verifier") != testVerifier ||
+			r.PostForm.Get("client_id") != testClientID ||
+			r.PostForm.Get("redirect_uri") != testRedirectURL {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     m.idToken,
+		})
+	})
+
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockIssuer) provider() *Provider {
+	return NewProvider(Config{
+		Issuer:      m.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+		Scopes:      []string{"openid", "profile"},
+	})
+}
+
+// 有效的ID令牌声明，测试用例在此基础上修改
+func (m *mockIssuer) claims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":                m.server.URL,
+		"sub":                "user-1",
+		"aud":                testClientID,
+		"exp":                now.Add(time.Hour).Unix(),
+		"iat":                now.Unix(),
+		"nonce":              testNonce,
+		"preferred_username": "alice",
+		"email":              "alice@example.com",
+		"groups_name":        "staff",
+	}
+}
+
+func (m *mockIssuer) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	return signToken(t, jwt.SigningMethodRS256, m.kid, m.key, claims)
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	raw, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) jsonWebKey {
+	return jsonWebKey{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	m := newMockIssuer(t)
+
+	authURL, err := m.provider().AuthCodeURL(context.Background(), "state", testNonce, testVerifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != m.server.URL+"/authorize" {
+		t.Errorf("authorization endpoint = %s", got)
+	}
+
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURL,
+		"scope":                 "openid profile",
+		"state":                 "state",
+		"nonce":                 testNonce,
+		"code_challenge":        CodeChallenge(testVerifier),
+		"code_challenge_method": "S256",
+	}
+	for name, value := range want {
+		if got := u.Query().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	m := newMockIssuer(t)
+	m.discoveryIssuer = "https://evil.example"
+
+	if _, err := m.provider().Issuer(context.Background()); err == nil {
+		t.Fatal("discovery accepted a document for a different issuer")
+	}
+}
+
+func TestDiscoveryFailureIsRetried(t *testing.T) {
+	m := newMockIssuer(t)
+	m.discoveryIssuer = "https://evil.example"
+	p := m.provider()
+
+	if _, err := p.Issuer(context.Background()); err == nil {
+		t.Fatal("expected discovery to fail")
+	}
+
+	m.discoveryIssuer = ""
+	issuer, err := p.Issuer(context.Background())
+	if err != nil {
+		t.Fatalf("discovery was not retried: %v", err)
+	}
+	if issuer != m.server.URL {
+		t.Errorf("issuer = %s, want %s", issuer, m.server.URL)
+	}
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// RFC 7636附录B的示例
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	if got := CodeChallenge(verifier); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("CodeChallenge() = %s", got)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	m := newMockIssuer(t)
+	m.idToken = m.sign(t, m.claims())
+
+	claims, err := m.provider().Exchange(context.Background(), testCode, testVerifier, testNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.Subject != "user-1" {
+		t.Errorf("Subject = %s", claims.Subject)
+	}
+	if claims.PreferredUsername != "alice" || claims.Email != "alice@example.com" {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+	if got := claims.Claim("groups_name"); got != "staff" {
+		t.Errorf("Claim(groups_name) = %q", got)
+	}
+}
+
+func TestExchangeRejectedCode(t *testing.T) {
+	m := newMockIssuer(t)
+	m.idToken = m.sign(t, m.claims())
+
+	_, err := m.provider().Exchange(context.Background(), "wrong-code", testVerifier, testNonce)
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Fatalf("Exchange() error = %v, want token endpoint error", err)
+	}
+
+	// PKCE校验值不匹配同样被拒绝
+	if _, err := m.provider().Exchange(context.Background(), testCode, "wrong-verifier", testNonce); err == nil {
+		t.Fatal("Exchange() accepted a wrong code_verifier")
+	}
+}
+
+func TestExchangeMissingIDToken(t *testing.T) {
+	m := newMockIssuer(t)
+
+	if _, err := m.provider().Exchange(context.Background(), testCode, testVerifier, testNonce); err == nil {
+		t.Fatal("Exchange() accepted a response without id_token")
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	m := newMockIssuer(t)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token func() string
+		nonce string
+	}{
+		{
+			name:  "nonce mismatch",
+			token: func() string { return m.sign(t, m.claims()) },
+			nonce: "other-nonce",
+		},
+		{
+			name:  "empty expected nonce",
+			token: func() string { return m.sign(t, m.claims()) },
+			nonce: "",
+		},
+		{
+			name: "wrong audience",
+			token: func() string {
+				claims := m.claims()
+				claims["aud"] = "other-client"
+				return m.sign(t, claims)
+			},
+			nonce: testNonce,
+		},
+		{
+			name: "wrong issuer",
+			token: func() string {
+				claims := m.claims()
+				claims["iss"] = "https://evil.example"
+				return m.sign(t, claims)
+			},
+			nonce: testNonce,
+		},
+		{
+			name: "expired",
+			token: func() string {
+				claims := m.claims()
+				claims["exp"] = time.Now().Add(-time.Minute).Unix()
+				return m.sign(t, claims)
+			},
+			nonce: testNonce,
+		},
+		{
+			name: "missing exp",
+			token: func() string {
+				claims := m.claims()
+				delete(claims, "exp")
+				return m.sign(t, claims)
+			},
+			nonce: testNonce,
+		},
+		{
+			name: "missing sub",
+			token: func() string {
+				claims := m.claims()
+				delete(claims, "sub")
+				return m.sign(t, claims)
+			},
+			nonce: testNonce,
+		},
+		{
+			name: "unknown kid",
+			token: func() string {
+				return signToken(t, jwt.SigningMethodRS256, "key-2", otherKey, m.claims())
+			},
+			nonce: testNonce,
+		},
+		{
+			name: "signed by another key with known kid",
+			token: func() string {
+				return signToken(t, jwt.SigningMethodRS256, m.kid, otherKey, m.claims())
+			},
+			nonce: testNonce,
+		},
+		{
+			name: "encryption key",
+			token: func() string {
+				return signToken(t, jwt.SigningMethodRS256, "enc-key", m.key, m.claims())
+			},
+			nonce: testNonce,
+		},
+		{
+			name: "hmac algorithm",
+			token: func() string {
+				return signToken(t, jwt.SigningMethodHS256, m.kid, []byte("secret"), m.claims())
+			},
+			nonce: testNonce,
+		},
+		{
+			name: "none algorithm",
+			token: func() string {
+				return signToken(t, jwt.SigningMethodNone, m.kid, jwt.UnsafeAllowNoneSignatureType, m.claims())
+			},
+			nonce: testNonce,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := m.provider().VerifyIDToken(context.Background(), tt.token(), tt.nonce)
+			if err == nil {
+				t.Fatal("VerifyIDToken() accepted an invalid token")
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenWithoutKid(t *testing.T) {
+	m := newMockIssuer(t)
+	p := m.provider()
+
+	// 先加载JWKS，此时只有一个签名密钥
+	if _, err := p.VerifyIDToken(context.Background(), m.sign(t, m.claims()), testNonce); err != nil {
+		t.Fatal(err)
+	}
+
+	token := signToken(t, jwt.SigningMethodRS256, "", m.key, m.claims())
+	if _, err := p.VerifyIDToken(context.Background(), token, testNonce); err != nil {
+		t.Fatalf("VerifyIDToken() rejected a token without kid: %v", err)
+	}
+}
+
+func TestJWKSRefreshIsRateLimited(t *testing.T) {
+	m := newMockIssuer(t)
+	p := m.provider()
+
+	if _, err := p.VerifyIDToken(context.Background(), m.sign(t, m.claims()), testNonce); err != nil {
+		t.Fatal(err)
+	}
+
+	// 伪造的kid不会在刷新间隔内再次请求JWKS
+	for i := 0; i < 3; i++ {
+		token := signToken(t, jwt.SigningMethodRS256, "forged", m.key, m.claims())
+		if _, err := p.VerifyIDToken(context.Background(), token, testNonce); err == nil {
+			t.Fatal("VerifyIDToken() accepted an unknown kid")
+		}
+	}
+
+	if got := atomic.LoadInt32(&m.jwksRequests); got != 1 {
+		t.Errorf("jwks requested %d times, want 1", got)
+	}
+}
+
+func TestJWKSRefreshOnKeyRotation(t *testing.T) {
+	m := newMockIssuer(t)
+	p := m.provider()
+
+	if _, err := p.VerifyIDToken(context.Background(), m.sign(t, m.claims()), testNonce); err != nil {
+		t.Fatal(err)
+	}
+
+	// 身份提供方轮换密钥，刷新间隔过后使用新密钥签名的令牌
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.key, m.kid = newKey, "key-2"
+	p.keysFetched = time.Now().Add(-jwksRefreshInterval)
+
+	if _, err := p.VerifyIDToken(context.Background(), m.sign(t, m.claims()), testNonce); err != nil {
+		t.Fatalf("VerifyIDToken() after key rotation: %v", err)
+	}
+	if got := atomic.LoadInt32(&m.jwksRequests); got != 2 {
+		t.Errorf("jwks requested %d times, want 2", got)
+	}
+}
+
+func TestECPublicKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwk := jsonWebKey{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		Y:   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}
+	pub, err := jwk.publicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := signToken(t, jwt.SigningMethodES256, "", key, jwt.MapClaims{"sub": "user-1"})
+	if _, err := jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return pub, nil }); err != nil {
+		t.Errorf("token signed with the EC key failed to verify: %v", err)
+	}
+
+	// 不在曲线上的点被拒绝
+	jwk.Y = jwk.X
+	if _, err := jwk.publicKey(); err == nil {
+		t.Error("publicKey() accepted a point that is not on the curve")
+	}
+}
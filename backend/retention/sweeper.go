@@ -0,0 +1,52 @@
+// Package retention 定期删除已过期的剪贴板项目及其文件
+package retention
+
+import (
+	"log"
+	"time"
+
+	"github.com/weicopy/backend/events"
+	"github.com/weicopy/backend/models"
+)
+
+// 每批删除的项目数量，避免长时间占用数据库
+const sweepBatchSize = 500
+
+// Start 启动后台清理任务，每隔interval删除一次过期项目
+func Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			Sweep(time.Now())
+			<-ticker.C
+		}
+	}()
+}
+
+// Sweep 删除截至now已过期的全部项目，并向在线设备推送删除事件，返回删除的数量
+func Sweep(now time.Time) int {
+	total := 0
+	for {
+		expired, err := models.DeleteExpiredClipboardItems(now, sweepBatchSize)
+		if err != nil {
+			log.Printf("retention: failed to delete expired items: %v", err)
+			return total
+		}
+
+		for _, item := range expired {
+			events.Publish(item.UserID, models.DeletedChange(item.Tombstone))
+		}
+		total += len(expired)
+
+		if len(expired) < sweepBatchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		log.Printf("retention: deleted %d expired clipboard items", total)
+	}
+	return total
+}
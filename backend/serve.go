@@ -0,0 +1,169 @@
+package main
+
+import (
+	"log"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/weicopy/backend/config"
+	"github.com/weicopy/backend/controllers"
+	"github.com/weicopy/backend/middlewares"
+	"github.com/weicopy/backend/models"
+	"github.com/weicopy/backend/retention"
+)
+
+// 启动HTTP服务
+func runServe() {
+	// 设置运行模式
+	gin.SetMode(getEnv("GIN_MODE", "debug"))
+	config.LogDeprecations()
+
+	// 初始化数据库
+	models.ConnectDatabase()
+
+	// 定期清理过期的剪贴板项目
+	retention.Start(config.GetRetentionSweepInterval())
+
+	// 创建Gin实例
+	r := gin.Default()
+
+	// 只信任配置的反向代理转发的客户端IP，登录限制和设备记录均依赖该地址
+	if err := r.SetTrustedProxies(config.GetTrustedProxies()); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	// 配置CORS
+	r.Use(cors.New(cors.Config{
+		AllowOrigins:     []string{"*"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "Last-Event-ID", "X-Expires-In", "X-Expires-At", "X-Max-Reads", "X-Burn-After-Read"},
+		ExposeHeaders:    []string{"Content-Length", "X-Item-ID", "Retry-After"},
+		AllowCredentials: true,
+	}))
+
+	// 路由组
+	api := r.Group("/api")
+	{
+		// 认证路由
+		auth := api.Group("/auth")
+		{
+			auth.POST("/register", controllers.Register)
+			auth.POST("/login", controllers.Login)
+			auth.POST("/login/2fa", controllers.LoginTwoFactor)
+			auth.POST("/refresh", controllers.Refresh)
+			// 新设备使用配对码换取令牌，无需密码
+			auth.POST("/pair", controllers.PairDevice)
+			auth.POST("/logout", middlewares.AuthRequired(), controllers.Logout)
+			auth.POST("/logout-all", middlewares.AuthRequired(), middlewares.RequireScope(models.ScopeAccountAdmin), controllers.LogoutAll)
+			// 任意有效令牌均可查询自身账户信息，无需额外权限范围
+			auth.GET("/me", middlewares.AuthRequired(), controllers.GetCurrentUser)
+			auth.DELETE("/me", middlewares.AuthRequired(), middlewares.RequireScope(models.ScopeAccountAdmin), controllers.DeleteAccount)
+			auth.PUT("/password", middlewares.AuthRequired(), middlewares.RequireScope(models.ScopeAccountAdmin), controllers.ChangePassword)
+			auth.PUT("/settings", middlewares.AuthRequired(), middlewares.RequireScope(models.ScopeAccountAdmin), controllers.UpdateSettings)
+
+			// OpenID Connect单点登录
+			auth.GET("/oidc/config", controllers.GetOIDCConfig)
+			auth.GET("/oidc/login", controllers.OIDCLogin)
+			auth.GET("/oidc/callback", controllers.OIDCCallback)
+			auth.POST("/oidc/link", middlewares.AuthRequired(), middlewares.RequireScope(models.ScopeAccountAdmin), controllers.LinkOIDCIdentity)
+			auth.POST("/oidc/reauth", middlewares.AuthRequired(), middlewares.RequireScope(models.ScopeAccountAdmin), controllers.ReauthenticateOIDC)
+
+			// 通行密钥（WebAuthn）登录和管理
+			auth.POST("/webauthn/login/options", controllers.WebAuthnLoginOptions)
+			auth.POST("/webauthn/login", controllers.WebAuthnLogin)
+			passkeys := auth.Group("/webauthn", middlewares.AuthRequired(), middlewares.RequireScope(models.ScopeAccountAdmin))
+			{
+				passkeys.POST("/register/options", controllers.WebAuthnRegisterOptions)
+				passkeys.POST("/register", controllers.WebAuthnRegister)
+				passkeys.GET("/credentials", controllers.GetWebAuthnCredentials)
+				passkeys.DELETE("/credentials/:id", controllers.DeleteWebAuthnCredential)
+			}
+
+			// 两步验证管理
+			twoFactor := auth.Group("/2fa", middlewares.AuthRequired(), middlewares.RequireScope(models.ScopeAccountAdmin))
+			{
+				twoFactor.POST("/setup", controllers.SetupTwoFactor)
+				twoFactor.POST("/enable", controllers.EnableTwoFactor)
+				twoFactor.POST("/disable", controllers.DisableTwoFactor)
+				twoFactor.POST("/recovery-codes", controllers.RegenerateRecoveryCodes)
+			}
+		}
+
+		// 管理员路由
+		admin := api.Group("/admin", middlewares.AuthRequired(), middlewares.RequireScope(models.ScopeAccountAdmin), middlewares.AdminRequired())
+		{
+			admin.GET("/lockouts", controllers.GetLoginLockouts)
+			admin.DELETE("/lockouts/:id", controllers.DeleteLoginLockout)
+			admin.GET("/invites", controllers.GetInvites)
+			admin.POST("/invites", controllers.CreateInvite)
+			admin.DELETE("/invites/:id", controllers.RevokeInvite)
+			admin.GET("/users", controllers.GetUsers)
+			admin.POST("/users", controllers.CreateUser)
+			admin.PATCH("/users/:id", controllers.UpdateUser)
+			admin.DELETE("/users/:id", controllers.DeleteUser)
+			admin.PUT("/users/:id/password", controllers.ResetUserPassword)
+			admin.GET("/users/:id/usage", controllers.GetUserUsage)
+			admin.PUT("/users/:id/quota", controllers.UpdateUserQuota)
+		}
+
+		// 剪贴板路由 - 需要认证，各路由声明所需的权限范围
+		read := middlewares.RequireScope(models.ScopeClipboardRead)
+		write := middlewares.RequireScope(models.ScopeClipboardWrite)
+		remove := middlewares.RequireScope(models.ScopeClipboardDelete)
+
+		clipboard := api.Group("/clipboard").Use(middlewares.AuthRequired())
+		{
+			clipboard.GET("/", read, controllers.GetClipboardItems)
+			clipboard.GET("/latest", read, controllers.GetLatestClipboardItem)
+			clipboard.GET("/changes", read, controllers.GetClipboardChanges)
+			clipboard.GET("/events", read, controllers.StreamClipboardEvents)
+			// WebSocket中的上传消息在处理时另行检查写入权限
+			clipboard.GET("/ws", read, controllers.SyncWebSocket)
+			clipboard.POST("/text", write, controllers.AddTextItem)
+			clipboard.POST("/file", write, controllers.UploadFile)
+			clipboard.POST("/image", write, controllers.UploadImage)
+			clipboard.GET("/file/:id", read, controllers.GetFile)
+			clipboard.GET("/file/:id/url", read, controllers.GetFileURL)
+			clipboard.PATCH("/:id", write, controllers.UpdateClipboardItem)
+			clipboard.DELETE("/:id", remove, controllers.DeleteClipboardItem)
+		}
+
+		// 签名下载链接，凭URL中的签名访问，无需认证头
+		api.GET("/files/:id", controllers.DownloadSignedFile)
+
+		// 分享链接管理
+		shares := api.Group("/shares").Use(middlewares.AuthRequired())
+		{
+			shares.GET("", read, controllers.GetShares)
+			shares.POST("", read, write, controllers.CreateShare)
+			shares.DELETE("/:id", write, controllers.RevokeShare)
+		}
+
+		// 个人访问令牌路由 - 需要认证和账户管理权限
+		tokens := api.Group("/tokens").Use(middlewares.AuthRequired(), middlewares.RequireScope(models.ScopeAccountAdmin))
+		{
+			tokens.GET("", controllers.GetAPITokens)
+			tokens.POST("", controllers.CreateAPIToken)
+			tokens.DELETE("/:id", controllers.DeleteAPIToken)
+		}
+
+		// 设备路由 - 需要认证和账户管理权限
+		devices := api.Group("/devices").Use(middlewares.AuthRequired(), middlewares.RequireScope(models.ScopeAccountAdmin))
+		{
+			devices.GET("", controllers.GetDevices)
+			devices.POST("/pairing", controllers.CreatePairingCode)
+			devices.PATCH("/:id", controllers.UpdateDevice)
+			devices.DELETE("/:id", controllers.DeleteDevice)
+		}
+	}
+
+	// 公开分享链接，无需登录
+	r.GET("/s/:token", controllers.ViewShare)
+	r.POST("/s/:token", controllers.ViewShare)
+
+	// 启动服务器
+	port := getEnv("PORT", "8081")
+	if err := r.Run(":" + port); err != nil {
+		log.Fatalf("Failed to start server: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Local 将文件保存在本地目录中
+type Local struct {
+	root string
+}
+
+// NewLocal 使用root目录保存文件，目录不存在时创建
+func NewLocal(root string) (*Local, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("create upload directory: %w", err)
+	}
+	return &Local{root: root}, nil
+}
+
+// Put 先写入临时文件再重命名，避免读取到写了一半的文件
+func (l *Local) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	filePath := l.path(key)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filePath)
+}
+
+// OpenRange 打开文件并定位到offset
+func (l *Local) OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	file, err := os.Open(l.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotExist
+		}
+		return nil, err
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if length < 0 {
+		return file, nil
+	}
+	return limitedFile{Reader: io.LimitReader(file, length), Closer: file}, nil
+}
+
+// Stat 获取文件大小和修改时间
+func (l *Local) Stat(ctx context.Context, key string) (*Info, error) {
+	info, err := os.Stat(l.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotExist
+		}
+		return nil, err
+	}
+	return &Info{Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// Delete 删除文件
+func (l *Local) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(l.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// 将键转换为根目录下的路径，Clean保证结果不会超出根目录
+func (l *Local) path(key string) string {
+	return filepath.Join(l.root, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+type limitedFile struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,151 @@
+// Package storage 保存剪贴板文件的存储后端，支持本地目录和兼容S3的对象存储
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/weicopy/backend/config"
+)
+
+// ErrNotExist 文件在存储后端中不存在
+var ErrNotExist = errors.New("file does not exist")
+
+// Info 文件的元信息
+type Info struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// Storage 文件存储后端，key为不含前导斜杠的相对路径
+type Storage interface {
+	// Put 写入size字节的文件，已存在时覆盖
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// OpenRange 从offset开始读取length字节，length小于0时读取到文件末尾
+	OpenRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// Stat 获取文件大小和修改时间，文件不存在时返回ErrNotExist
+	Stat(ctx context.Context, key string) (*Info, error)
+	// Delete 删除文件，文件不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+}
+
+// Default 当前使用的存储后端，由Setup根据配置创建
+var Default Storage
+
+// Setup 根据配置创建存储后端：STORAGE_BACKEND为s3时使用对象存储，否则使用本地上传目录
+func Setup() error {
+	switch config.GetStorageBackend() {
+	case "", "local":
+		local, err := NewLocal(config.GetUploadPath())
+		if err != nil {
+			return err
+		}
+		Default = local
+	case "s3":
+		s3, err := NewS3(S3Config{
+			Endpoint:        config.GetS3Endpoint(),
+			Region:          config.GetS3Region(),
+			Bucket:          config.GetS3Bucket(),
+			Prefix:          config.GetS3Prefix(),
+			AccessKeyID:     config.GetS3AccessKeyID(),
+			SecretAccessKey: config.GetS3SecretAccessKey(),
+		})
+		if err != nil {
+			return err
+		}
+		Default = s3
+	default:
+		return fmt.Errorf("unknown storage backend %q", config.GetStorageBackend())
+	}
+	return nil
+}
+
+// Object 已打开的文件，支持Seek，可直接用于http.ServeContent
+// 内容在首次读取时按当前位置通过OpenRange获取，Seek后重新获取
+type Object struct {
+	ctx     context.Context
+	storage Storage
+	key     string
+	info    *Info
+	offset  int64
+	body    io.ReadCloser
+}
+
+// Open 打开文件，文件不存在时返回ErrNotExist
+func Open(ctx context.Context, s Storage, key string) (*Object, error) {
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return &Object{ctx: ctx, storage: s, key: key, info: info}, nil
+}
+
+// Size 文件大小
+func (o *Object) Size() int64 {
+	return o.info.Size
+}
+
+// ModTime 文件的修改时间
+func (o *Object) ModTime() time.Time {
+	return o.info.ModTime
+}
+
+// Read 从当前位置读取内容
+func (o *Object) Read(p []byte) (int, error) {
+	if o.offset >= o.info.Size {
+		return 0, io.EOF
+	}
+
+	if o.body == nil {
+		body, err := o.storage.OpenRange(o.ctx, o.key, o.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		o.body = body
+	}
+
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+// Seek 移动读取位置，位置变化时关闭已获取的内容
+func (o *Object) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = o.offset + offset
+	case io.SeekEnd:
+		pos = o.info.Size + offset
+	default:
+		return 0, errors.New("storage: invalid whence")
+	}
+	if pos < 0 {
+		return 0, errors.New("storage: negative position")
+	}
+
+	if pos != o.offset {
+		o.closeBody()
+		o.offset = pos
+	}
+	return pos, nil
+}
+
+// Close 关闭已获取的内容
+func (o *Object) Close() error {
+	return o.closeBody()
+}
+
+func (o *Object) closeBody() error {
+	if o.body == nil {
+		return nil
+	}
+	err := o.body.Close()
+	o.body = nil
+	return err
+}
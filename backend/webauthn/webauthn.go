@@ -0,0 +1,401 @@
+// Package webauthn 实现WebAuthn（通行密钥）注册和断言的服务端校验
+// 不校验认证器证明（attestation），等同于依赖方请求attestation为none
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// 认证器数据中的标志位
+const (
+	flagUserPresent      = 0x01
+	flagUserVerified     = 0x04
+	flagAttestedCredData = 0x40
+)
+
+// COSE算法标识
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// Config 依赖方配置
+type Config struct {
+	// 依赖方ID，通常为站点域名，不含协议和端口
+	RPID   string
+	RPName string
+	// 允许的来源，如https://weicopy.example.com
+	Origins []string
+}
+
+// Credential 注册成功后需要保存的凭据信息
+type Credential struct {
+	ID        []byte
+	PublicKey []byte
+	SignCount uint32
+}
+
+// GenerateChallenge 生成随机挑战值
+func GenerateChallenge() ([]byte, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// ChallengeFromClientData 从clientDataJSON中取出挑战值，用于查找服务端保存的挑战
+func ChallengeFromClientData(clientDataJSON []byte) ([]byte, error) {
+	var clientData collectedClientData
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return nil, fmt.Errorf("invalid clientDataJSON: %w", err)
+	}
+	return base64.RawURLEncoding.DecodeString(clientData.Challenge)
+}
+
+// VerifyRegistration 校验navigator.credentials.create()的结果，返回新凭据
+func (c Config) VerifyRegistration(challenge, clientDataJSON, attestationObject []byte, requireUserVerification bool) (*Credential, error) {
+	if err := c.verifyClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	var attestation struct {
+		Fmt      string          `cbor:"fmt"`
+		AuthData []byte          `cbor:"authData"`
+		AttStmt  cbor.RawMessage `cbor:"attStmt"`
+	}
+	if err := cbor.Unmarshal(attestationObject, &attestation); err != nil {
+		return nil, fmt.Errorf("invalid attestationObject: %w", err)
+	}
+
+	authData, err := c.parseAuthenticatorData(attestation.AuthData, requireUserVerification)
+	if err != nil {
+		return nil, err
+	}
+	if authData.flags&flagAttestedCredData == 0 || len(authData.rest) < 18 {
+		return nil, errors.New("authenticator data does not contain a credential")
+	}
+
+	// 跳过16字节的AAGUID，读取凭据ID和COSE公钥
+	rest := authData.rest[16:]
+	idLength := int(binary.BigEndian.Uint16(rest[:2]))
+	rest = rest[2:]
+	if len(rest) < idLength {
+		return nil, errors.New("authenticator data is truncated")
+	}
+	credentialID := rest[:idLength]
+	rest = rest[idLength:]
+
+	// 公钥之后可能还有扩展数据，只读取一个CBOR数据项
+	decoder := cbor.NewDecoder(bytes.NewReader(rest))
+	var raw cbor.RawMessage
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("invalid credential public key: %w", err)
+	}
+	if _, err := parsePublicKey(raw); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:        append([]byte(nil), credentialID...),
+		PublicKey: append([]byte(nil), raw...),
+		SignCount: authData.signCount,
+	}, nil
+}
+
+// VerifyAssertion 校验navigator.credentials.get()的结果，返回认证器的新签名计数
+func (c Config) VerifyAssertion(challenge []byte, credential Credential, clientDataJSON, authenticatorData, signature []byte, requireUserVerification bool) (uint32, error) {
+	if err := c.verifyClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := c.parseAuthenticatorData(authenticatorData, requireUserVerification)
+	if err != nil {
+		return 0, err
+	}
+
+	publicKey, err := parsePublicKey(credential.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), authenticatorData...), clientDataHash[:]...)
+	if !publicKey.verify(signed, signature) {
+		return 0, errors.New("invalid signature")
+	}
+
+	// 签名计数不增反降说明认证器可能被克隆；两者均为0表示认证器不支持计数
+	if (authData.signCount != 0 || credential.SignCount != 0) && authData.signCount <= credential.SignCount {
+		return 0, errors.New("signature counter did not increase")
+	}
+
+	return authData.signCount, nil
+}
+
+// UserVerified 认证器数据中是否带有用户验证标志，应在VerifyAssertion校验签名成功后使用
+func UserVerified(authenticatorData []byte) bool {
+	return len(authenticatorData) > 32 && authenticatorData[32]&flagUserVerified != 0
+}
+
+type collectedClientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+func (c Config) verifyClientData(clientDataJSON []byte, expectedType string, challenge []byte) error {
+	var clientData collectedClientData
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return fmt.Errorf("invalid clientDataJSON: %w", err)
+	}
+
+	if clientData.Type != expectedType {
+		return fmt.Errorf("unexpected client data type %q", clientData.Type)
+	}
+
+	received, err := base64.RawURLEncoding.DecodeString(clientData.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(received, challenge) != 1 {
+		return errors.New("challenge mismatch")
+	}
+
+	for _, origin := range c.Origins {
+		if clientData.Origin == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("origin %q is not allowed", clientData.Origin)
+}
+
+type authenticatorData struct {
+	flags     byte
+	signCount uint32
+	rest      []byte
+}
+
+func (c Config) parseAuthenticatorData(data []byte, requireUserVerification bool) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, errors.New("authenticator data is too short")
+	}
+
+	rpIDHash := sha256.Sum256([]byte(c.RPID))
+	if subtle.ConstantTimeCompare(data[:32], rpIDHash[:]) != 1 {
+		return nil, errors.New("relying party ID mismatch")
+	}
+
+	flags := data[32]
+	if flags&flagUserPresent == 0 {
+		return nil, errors.New("user presence is required")
+	}
+	if requireUserVerification && flags&flagUserVerified == 0 {
+		return nil, errors.New("user verification is required")
+	}
+
+	return &authenticatorData{
+		flags:     flags,
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+		rest:      data[37:],
+	}, nil
+}
+
+// COSE_Key中用到的字段，键为整数
+type coseKey struct {
+	Kty int64  `cbor:"1,keyasint"`
+	Alg int64  `cbor:"3,keyasint"`
+	Crv int64  `cbor:"-1,keyasint,omitempty"`
+	X   []byte `cbor:"-2,keyasint,omitempty"`
+	Y   []byte `cbor:"-3,keyasint,omitempty"`
+}
+
+// RSA密钥的-1和-2分别为模数和指数，与EC密钥的字段编号重叠，单独解析
+type rsaCoseKey struct {
+	N []byte `cbor:"-1,keyasint"`
+	E []byte `cbor:"-2,keyasint"`
+}
+
+type publicKey struct {
+	key interface{}
+}
+
+func (k publicKey) verify(data, signature []byte) bool {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, signature)
+	}
+	return false
+}
+
+// 解析COSE格式的公钥，仅支持ES256、RS256和EdDSA
+func parsePublicKey(raw []byte) (*publicKey, error) {
+	var header struct {
+		Kty int64 `cbor:"1,keyasint"`
+		Alg int64 `cbor:"3,keyasint"`
+	}
+	if err := cbor.Unmarshal(raw, &header); err != nil {
+		return nil, fmt.Errorf("invalid credential public key: %w", err)
+	}
+
+	switch header.Alg {
+	case AlgES256:
+		var key coseKey
+		if err := cbor.Unmarshal(raw, &key); err != nil {
+			return nil, fmt.Errorf("invalid credential public key: %w", err)
+		}
+		// kty=2(EC2)，crv=1(P-256)
+		if key.Kty != 2 || key.Crv != 1 {
+			return nil, errors.New("unsupported EC key")
+		}
+		x, y := new(big.Int).SetBytes(key.X), new(big.Int).SetBytes(key.Y)
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("invalid EC point")
+		}
+		return &publicKey{key: &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}}, nil
+	case AlgRS256:
+		var key rsaCoseKey
+		if err := cbor.Unmarshal(raw, &key); err != nil {
+			return nil, fmt.Errorf("invalid credential public key: %w", err)
+		}
+		e := new(big.Int).SetBytes(key.E)
+		if header.Kty != 3 || len(key.N) == 0 || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("unsupported RSA key")
+		}
+		return &publicKey{key: &rsa.PublicKey{N: new(big.Int).SetBytes(key.N), E: int(e.Int64())}}, nil
+	case AlgEdDSA:
+		var key coseKey
+		if err := cbor.Unmarshal(raw, &key); err != nil {
+			return nil, fmt.Errorf("invalid credential public key: %w", err)
+		}
+		// kty=1(OKP)，crv=6(Ed25519)
+		if key.Kty != 1 || key.Crv != 6 || len(key.X) != ed25519.PublicKeySize {
+			return nil, errors.New("unsupported OKP key")
+		}
+		return &publicKey{key: ed25519.PublicKey(key.X)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported credential algorithm %d", header.Alg)
+	}
+}
+
+// 浏览器端API使用的选项，二进制字段以base64url编码，由前端解码为ArrayBuffer
+type (
+	RelyingParty struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+
+	UserEntity struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	}
+
+	CredentialParameter struct {
+		Type string `json:"type"`
+		Alg  int64  `json:"alg"`
+	}
+
+	CredentialDescriptor struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+	}
+
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	}
+
+	// CreationOptions navigator.credentials.create()的publicKey选项
+	CreationOptions struct {
+		Challenge              string                 `json:"challenge"`
+		RP                     RelyingParty           `json:"rp"`
+		User                   UserEntity             `json:"user"`
+		PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+		Timeout                int                    `json:"timeout"`
+		ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+		AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+		Attestation            string                 `json:"attestation"`
+	}
+
+	// RequestOptions navigator.credentials.get()的publicKey选项
+	RequestOptions struct {
+		Challenge        string                 `json:"challenge"`
+		RPID             string                 `json:"rpId"`
+		Timeout          int                    `json:"timeout"`
+		AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+		UserVerification string                 `json:"userVerification"`
+	}
+)
+
+// 浏览器等待用户操作的超时时间（毫秒）
+const optionsTimeout = 120000
+
+// NewCreationOptions 生成注册选项，已注册的凭据会被排除以避免重复注册
+func (c Config) NewCreationOptions(challenge, userHandle []byte, username string, exclude [][]byte) CreationOptions {
+	return CreationOptions{
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		RP:        RelyingParty{ID: c.RPID, Name: c.RPName},
+		User: UserEntity{
+			ID:          base64.RawURLEncoding.EncodeToString(userHandle),
+			Name:        username,
+			DisplayName: username,
+		},
+		PubKeyCredParams: []CredentialParameter{
+			{Type: "public-key", Alg: AlgES256},
+			{Type: "public-key", Alg: AlgEdDSA},
+			{Type: "public-key", Alg: AlgRS256},
+		},
+		Timeout:            optionsTimeout,
+		ExcludeCredentials: descriptors(exclude),
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: "preferred",
+		},
+		Attestation: "none",
+	}
+}
+
+// NewRequestOptions 生成登录选项，allow为空时由认证器列出可发现凭据供用户选择
+// requireUserVerification为true时要求认证器验证用户（PIN或生物识别），否则仅在支持时验证
+func (c Config) NewRequestOptions(challenge []byte, allow [][]byte, requireUserVerification bool) RequestOptions {
+	userVerification := "preferred"
+	if requireUserVerification {
+		userVerification = "required"
+	}
+	return RequestOptions{
+		Challenge:        base64.RawURLEncoding.EncodeToString(challenge),
+		RPID:             c.RPID,
+		Timeout:          optionsTimeout,
+		AllowCredentials: descriptors(allow),
+		UserVerification: userVerification,
+	}
+}
+
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	list := make([]CredentialDescriptor, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, CredentialDescriptor{Type: "public-key", ID: base64.RawURLEncoding.EncodeToString(id)})
+	}
+	return list
+}
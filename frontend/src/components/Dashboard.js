@@ -1,5 +1,5 @@
 import React, { useState, useEffect, useRef, useCallback } from 'react';
-import { useAuth } from '../contexts/AuthContext';
+import { useAuth, isPasskeySupported } from '../contexts/AuthContext';
 import axios from 'axios';
 import {
   Container,
@@ -24,7 +24,10 @@ import {
   CardContent,
   CardMedia,
   Grid,
-  Tooltip
+  Tooltip,
+  Dialog,
+  DialogContent,
+  DialogActions
 } from '@mui/material';
 import {
   TextFields as TextIcon,
@@ -35,7 +38,9 @@ import {
   Refresh as RefreshIcon,
   Logout as LogoutIcon,
   Add as AddIcon,
-  ContentPaste as PasteIcon
+  ContentPaste as PasteIcon,
+  Key as KeyIcon,
+  Share as ShareIcon
 } from '@mui/icons-material';
 
 // 剪贴板项目类型
@@ -46,7 +51,7 @@ const ITEM_TYPES = {
 };
 
 const Dashboard = () => {
-  const { currentUser, logout } = useAuth();
+  const { currentUser, logout, registerPasskey } = useAuth();
   const [activeTab, setActiveTab] = useState(0);
   const [clipboardItems, setClipboardItems] = useState([]);
   const [loading, setLoading] = useState(true);
@@ -54,49 +59,106 @@ const Dashboard = () => {
   const [success, setSuccess] = useState('');
   const [textInput, setTextInput] = useState('');
   const [selectedFile, setSelectedFile] = useState(null);
+  // 已读取的阅后即焚图片，在对话框中显示，项目被删除后仍可查看
+  const [burnImageUrl, setBurnImageUrl] = useState('');
   const fileInputRef = useRef(null);
   const pasteAreaRef = useRef(null);
   
-  // Polling interval (ms)
+  // 事件流断开时的后备轮询间隔（ms）
   const POLLING_INTERVAL = 10000;
+  // 事件流被拒绝（如访问令牌过期）后重新连接的等待时间（ms）
+  const STREAM_RETRY_DELAY = 5000;
   const intervalRef = useRef(null);
+  const eventSourceRef = useRef(null);
+  const retryTimerRef = useRef(null);
+  // 最近收到的事件ID，重新连接时据此补发断线期间的变更
+  const lastEventIdRef = useRef('');
 
-  // Start/restart polling
-  // useCallback 是 React 提供的一个 Hook，它的主要作用是优化性能，防止在组件重新渲染时，不必要地重新创建函数。 可以把它想象成一个“函数记忆器”或者“函数缓存器”。
-  // 当组件第一次渲染时，useCallback 会执行你的函数定义，并把这个函数实例“记住”下来。
-  // 在后续的渲染中，useCallback 会比较依赖项数组里的值。
+  // 事件流断开期间立即拉取一次列表，之后定时拉取
   const startPolling = useCallback(() => {
-    // Clear existing interval
-    if (intervalRef.current) {
-      clearInterval(intervalRef.current);
-    }
-    
-    // Initial fetch
+    if (intervalRef.current) return;
     fetchClipboardItems();
-    
-    // Set new interval
     intervalRef.current = setInterval(() => {
       fetchClipboardItems();
     }, POLLING_INTERVAL);
   }, []);
 
+  const stopPolling = useCallback(() => {
+    if (intervalRef.current) {
+      clearInterval(intervalRef.current);
+      intervalRef.current = null;
+    }
+  }, []);
+
+  // 将变更事件应用到列表：created按ID插入或覆盖（置顶等修改同样以created下发），deleted移除
+  const applyEvent = useCallback((event) => {
+    setClipboardItems(items => {
+      const rest = items.filter(item => item.id !== event.item_id);
+      if (event.type !== 'created' || !event.item) return rest;
+      return [event.item, ...rest].sort((a, b) => new Date(b.created_at) - new Date(a.created_at));
+    });
+  }, []);
+
+  // 订阅剪贴板事件流。EventSource无法设置请求头，令牌和续传位置通过查询参数传递
+  const connectEvents = useCallback(() => {
+    eventSourceRef.current?.close();
+    clearTimeout(retryTimerRef.current);
+
+    const params = new URLSearchParams({ access_token: localStorage.getItem('token') || '' });
+    if (lastEventIdRef.current) {
+      params.set('last_event_id', lastEventIdRef.current);
+    }
+    const source = new EventSource(`/api/clipboard/events?${params}`);
+    eventSourceRef.current = source;
+
+    const handleEvent = (e) => {
+      lastEventIdRef.current = e.lastEventId;
+      applyEvent(JSON.parse(e.data));
+    };
+
+    source.onopen = () => {
+      stopPolling();
+      // 首次连接时拉取完整列表，之后由服务端补发断线期间的事件
+      if (!lastEventIdRef.current) {
+        fetchClipboardItems();
+      }
+    };
+    source.addEventListener('created', handleEvent);
+    source.addEventListener('deleted', handleEvent);
+    // 服务端无法补发全部事件时重新拉取列表
+    source.addEventListener('reset', () => fetchClipboardItems());
+
+    source.onerror = () => {
+      startPolling();
+      // 网络中断时EventSource会自动重连；连接被拒绝时先刷新令牌再手动重连
+      if (source.readyState === EventSource.CLOSED) {
+        retryTimerRef.current = setTimeout(async () => {
+          try {
+            await axios.get('/api/auth/me');
+          } catch (err) {
+            console.error(err);
+          }
+          connectEvents();
+        }, STREAM_RETRY_DELAY);
+      }
+    };
+  }, [applyEvent, startPolling, stopPolling]);
+
   // Initial setup and cleanup
   // useEffect 返回的函数是一个可选的 清理函数 (Cleanup Function)
   // 它的作用是在下一次 Effect 执行之前（如果依赖项发生变化）或者《组件卸载》时，执行一些清理操作。
-  // useEffect 是 React 中用于处理副作用的 Hook。它执行的时机取决于它的依赖项数组。
   useEffect(() => {
-    startPolling();
+    connectEvents();
     return () => {
-      if (intervalRef.current) {
-        clearInterval(intervalRef.current);
-      }
+      eventSourceRef.current?.close();
+      clearTimeout(retryTimerRef.current);
+      stopPolling();
     };
-  }, [startPolling]); 
-  // useEffect  依赖了 startPolling 而 startPolling 是 useCallback 创建的，这样可以避免不必要的重复触发
+  }, [connectEvents, stopPolling]);
 
-  // Modify refresh button handler
+  // 手动刷新时重新拉取列表
   const handleManualRefresh = () => {
-    startPolling(); // This will restart the polling
+    fetchClipboardItems();
   };
   
   // 粘贴事件监听
@@ -136,10 +198,9 @@ const Dashboard = () => {
     };
   }, []);
   
-  // 获取剪贴板项目
+  // 获取剪贴板项目。仅首次加载时显示加载状态，后台刷新不重新挂载列表中的图片
   const fetchClipboardItems = async () => {
     try {
-      setLoading(true);
       const response = await axios.get('/api/clipboard');
       setClipboardItems(response.data);
       setError('');
@@ -221,6 +282,47 @@ const Dashboard = () => {
     }
   };
   
+  // 读取阅后即焚文本并复制，达到读取次数后服务端会删除该项目
+  const copyBurnAfterRead = async (id) => {
+    try {
+      const response = await axios.get(`/api/clipboard/file/${id}`, { responseType: 'text' });
+      await copyToClipboard(response.data);
+      fetchClipboardItems();
+    } catch (err) {
+      setError(err.response?.status === 404 ? '内容已被读取' : '读取失败');
+      console.error(err);
+    }
+  };
+
+  // 读取阅后即焚图片并在对话框中显示，每次读取都会消耗一次次数
+  const revealBurnAfterReadImage = async (id) => {
+    try {
+      const response = await axios.get(`/api/clipboard/file/${id}`, { responseType: 'blob' });
+      setBurnImageUrl(URL.createObjectURL(response.data));
+      fetchClipboardItems();
+    } catch (err) {
+      setError(err.response?.status === 404 ? '内容已被读取' : '读取失败');
+      console.error(err);
+    }
+  };
+
+  const closeBurnImage = () => {
+    URL.revokeObjectURL(burnImageUrl);
+    setBurnImageUrl('');
+  };
+
+  // 创建24小时有效的分享链接并复制
+  const handleShare = async (id) => {
+    try {
+      const response = await axios.post('/api/shares', { item_id: id, expires_in_hours: 24 });
+      await navigator.clipboard.writeText(response.data.url);
+      setSuccess('分享链接已复制，24小时内有效');
+    } catch (err) {
+      setError(err.response?.data?.message || '创建分享链接失败');
+      console.error(err);
+    }
+  };
+
   // 删除项目
   const handleDelete = async (id) => {
     try {
@@ -243,6 +345,16 @@ const Dashboard = () => {
     logout();
   };
   
+  // 注册通行密钥
+  const handleRegisterPasskey = async () => {
+    try {
+      await registerPasskey(navigator.platform || 'Passkey');
+      setSuccess('通行密钥已添加');
+    } catch (err) {
+      setError(err.response?.data?.message || '添加通行密钥失败');
+    }
+  };
+
   // 关闭提示
   const handleCloseAlert = () => {
     setSuccess('');
@@ -288,12 +400,17 @@ const Dashboard = () => {
                   </Box>
                   <Box>
                     {item.type === ITEM_TYPES.TEXT && (
-                      <Tooltip title="复制到剪贴板">
-                        <IconButton size="small" onClick={() => copyToClipboard(item.content)}>
+                      <Tooltip title={item.max_reads > 0 ? '读取并复制（阅后即焚）' : '复制到剪贴板'}>
+                        <IconButton size="small" onClick={() => item.max_reads > 0 ? copyBurnAfterRead(item.id) : copyToClipboard(item.content)}>
                           <CopyIcon fontSize="small" />
                         </IconButton>
                       </Tooltip>
                     )}
+                    <Tooltip title="分享链接">
+                      <IconButton size="small" onClick={() => handleShare(item.id)}>
+                        <ShareIcon fontSize="small" />
+                      </IconButton>
+                    </Tooltip>
                     <Tooltip title="删除">
                       <IconButton size="small" onClick={() => handleDelete(item.id)}>
                         <DeleteIcon fontSize="small" />
@@ -302,18 +419,45 @@ const Dashboard = () => {
                   </Box>
                 </Box>
                 
-                {item.type === ITEM_TYPES.TEXT && (
+                {item.type === ITEM_TYPES.TEXT && item.max_reads > 0 && (
+                  <Typography variant="body1" color="text.secondary">
+                    阅后即焚内容，剩余 {item.max_reads - item.reads} 次读取
+                  </Typography>
+                )}
+                {item.type === ITEM_TYPES.TEXT && !(item.max_reads > 0) && (
                   <Typography variant="body1" sx={{ whiteSpace: 'pre-wrap', wordBreak: 'break-word' }}>
                     {item.content}
                   </Typography>
                 )}
                 
-                {item.type === ITEM_TYPES.IMAGE && (
+                {/* 阅后即焚图片不自动加载，点击后才读取，避免渲染和刷新列表时消耗读取次数 */}
+                {item.type === ITEM_TYPES.IMAGE && item.max_reads > 0 && (
+                  <Box>
+                    <Typography variant="body1" color="text.secondary">
+                      阅后即焚图片，剩余 {item.max_reads - item.reads} 次读取
+                    </Typography>
+                    <Button
+                      variant="outlined"
+                      size="small"
+                      startIcon={<ImageIcon />}
+                      sx={{ mt: 1 }}
+                      onClick={() => revealBurnAfterReadImage(item.id)}
+                    >
+                      查看图片
+                    </Button>
+                  </Box>
+                )}
+                {item.type === ITEM_TYPES.IMAGE && !(item.max_reads > 0) && (
                   <ImageWithAuth itemId={item.id} />
                 )}
                 
                 {item.type === ITEM_TYPES.FILE && (
-                  <FileDownloadWithAuth itemId={item.id} filename={item.filename} />
+                  <FileDownloadWithAuth
+                    itemId={item.id}
+                    filename={item.filename}
+                    remainingReads={item.max_reads > 0 ? item.max_reads - item.reads : null}
+                    onDownloaded={fetchClipboardItems}
+                  />
                 )}
               </CardContent>
             </Card>
@@ -335,6 +479,13 @@ const Dashboard = () => {
               <RefreshIcon />
             </IconButton>
           </Tooltip>
+          {isPasskeySupported() && (
+            <Tooltip title="添加通行密钥">
+              <IconButton onClick={handleRegisterPasskey}>
+                <KeyIcon />
+              </IconButton>
+            </Tooltip>
+          )}
           <Tooltip title="登出">
             <IconButton onClick={handleLogout}>
               <LogoutIcon />
@@ -472,6 +623,15 @@ const Dashboard = () => {
         renderClipboardItems()
       )}
       
+      <Dialog open={!!burnImageUrl} onClose={closeBurnImage} maxWidth="md">
+        <DialogContent>
+          <Box component="img" src={burnImageUrl} alt="阅后即焚图片" sx={{ display: 'block', maxWidth: '100%' }} />
+        </DialogContent>
+        <DialogActions>
+          <Button onClick={closeBurnImage}>关闭</Button>
+        </DialogActions>
+      </Dialog>
+      
       <Snackbar open={!!success} autoHideDuration={3000} onClose={handleCloseAlert}>
         <Alert onClose={handleCloseAlert} severity="success" sx={{ width: '100%' }}>
           {success}
@@ -538,13 +698,7 @@ const ImageWithAuth = ({ itemId }) => {
         size="small" 
         startIcon={<CopyIcon />} 
         sx={{ mt: 1 }}
-        onClick={async () => {
-          const response = await axios.get(`/api/clipboard/file/${itemId}`, {
-            responseType: 'blob'
-          });
-          const url = URL.createObjectURL(response.data);
-          window.open(url, '_blank');
-        }}
+        onClick={() => window.open(imageUrl, '_blank')}
       >
         查看原图
       </Button>
@@ -552,7 +706,8 @@ const ImageWithAuth = ({ itemId }) => {
   );
 };
 
-const FileDownloadWithAuth = ({ itemId, filename }) => {
+// remainingReads不为null时为阅后即焚文件，只在点击下载时读取
+const FileDownloadWithAuth = ({ itemId, filename, remainingReads, onDownloaded }) => {
   const [loading, setLoading] = useState(false);
 
   const handleDownload = async () => {
@@ -573,6 +728,11 @@ const FileDownloadWithAuth = ({ itemId, filename }) => {
       // Cleanup
       link.parentNode.removeChild(link);
       window.URL.revokeObjectURL(url);
+
+      // 阅后即焚文件下载后刷新剩余次数
+      if (remainingReads !== null) {
+        onDownloaded();
+      }
     } catch (err) {
       console.error('File download failed', err);
     } finally {
@@ -585,6 +745,11 @@ const FileDownloadWithAuth = ({ itemId, filename }) => {
       <Typography variant="body1">
         {filename}
       </Typography>
+      {remainingReads !== null && (
+        <Typography variant="body2" color="text.secondary">
+          阅后即焚文件，剩余 {remainingReads} 次读取
+        </Typography>
+      )}
       <Button 
         variant="outlined" 
         size="small" 
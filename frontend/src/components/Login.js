@@ -1,6 +1,7 @@
 import React, { useState, useEffect } from 'react';
 import { useNavigate, Link } from 'react-router-dom';
-import { useAuth } from '../contexts/AuthContext';
+import axios from 'axios';
+import { useAuth, isPasskeySupported } from '../contexts/AuthContext';
 import { 
   Container, 
   Box, 
@@ -15,9 +16,18 @@ import {
 const Login = () => {
   const [username, setUsername] = useState('');
   const [password, setPassword] = useState('');
+  const [code, setCode] = useState('');
   const [loading, setLoading] = useState(false);
-  const { login, error, currentUser } = useAuth();
+  const { login, loginWithPasskey, verifyTwoFactor, twoFactorChallenge, error, currentUser } = useAuth();
   const navigate = useNavigate();
+  const [ssoEnabled, setSsoEnabled] = useState(false);
+
+  useEffect(() => {
+    // 查询是否配置了单点登录
+    axios.get('/api/auth/oidc/config')
+      .then((response) => setSsoEnabled(response.data.enabled))
+      .catch(() => setSsoEnabled(false));
+  }, []);
 
   useEffect(() => {
     if (currentUser) {
@@ -30,7 +40,22 @@ const Login = () => {
     setLoading(true);
     
     try {
-      const success = await login(username, password);
+      const success = twoFactorChallenge
+        ? await verifyTwoFactor(code)
+        : await login(username, password);
+      if (success) {
+        navigate('/dashboard');
+      }
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const handlePasskeyLogin = async () => {
+    setLoading(true);
+
+    try {
+      const success = await loginWithPasskey(username);
       if (success) {
         navigate('/dashboard');
       }
@@ -68,7 +93,7 @@ const Login = () => {
               autoFocus
               value={username}
               onChange={(e) => setUsername(e.target.value)}
-              disabled={loading}
+              disabled={loading || !!twoFactorChallenge}
             />
             <TextField
               margin="normal"
@@ -81,8 +106,24 @@ const Login = () => {
               autoComplete="current-password"
               value={password}
               onChange={(e) => setPassword(e.target.value)}
-              disabled={loading}
+              disabled={loading || !!twoFactorChallenge}
             />
+            {twoFactorChallenge && (
+              <TextField
+                margin="normal"
+                required
+                fullWidth
+                name="code"
+                label="验证码或恢复码"
+                id="code"
+                autoComplete="one-time-code"
+                helperText="请输入验证器应用中的6位验证码，或一个未使用的恢复码"
+                autoFocus
+                value={code}
+                onChange={(e) => setCode(e.target.value)}
+                disabled={loading}
+              />
+            )}
             <Button
               type="submit"
               fullWidth
@@ -90,8 +131,29 @@ const Login = () => {
               sx={{ mt: 3, mb: 2 }}
               disabled={loading}
             >
-              {loading ? <CircularProgress size={24} /> : '登录'}
+              {loading ? <CircularProgress size={24} /> : (twoFactorChallenge ? '验证' : '登录')}
             </Button>
+            {isPasskeySupported() && !twoFactorChallenge && (
+              <Button
+                fullWidth
+                variant="outlined"
+                sx={{ mb: 2 }}
+                onClick={handlePasskeyLogin}
+                disabled={loading}
+              >
+                使用通行密钥登录
+              </Button>
+            )}
+            {ssoEnabled && !twoFactorChallenge && (
+              <Button
+                fullWidth
+                variant="outlined"
+                href="/api/auth/oidc/login"
+                disabled={loading}
+              >
+                使用单点登录
+              </Button>
+            )}
             <Box sx={{ textAlign: 'center', mt: 2 }}>
               <Link to="/register" style={{ textDecoration: 'none' }}>
                 <Typography variant="body2" color="primary">
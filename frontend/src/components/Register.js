@@ -1,5 +1,5 @@
 import React, { useState } from 'react';
-import { useNavigate, Link } from 'react-router-dom';
+import { useNavigate, useSearchParams, Link } from 'react-router-dom';
 import { useAuth } from '../contexts/AuthContext';
 import { 
   Container, 
@@ -16,6 +16,9 @@ const Register = () => {
   const [username, setUsername] = useState('');
   const [password, setPassword] = useState('');
   const [confirmPassword, setConfirmPassword] = useState('');
+  const [searchParams] = useSearchParams();
+  // 邀请链接形如 /register?invite=XXXX-XXXX-XXXX
+  const [inviteCode, setInviteCode] = useState(searchParams.get('invite') || '');
   const [loading, setLoading] = useState(false);
   const [formError, setFormError] = useState('');
   const { register, error } = useAuth();
@@ -34,7 +37,7 @@ const Register = () => {
     setLoading(true);
     
     try {
-      const success = await register(username, password);
+      const success = await register(username, password, inviteCode.trim());
       if (success) {
         // 注册成功，跳转到登录页
         navigate('/login', { state: { message: '注册成功，请登录' } });
@@ -105,6 +108,17 @@ const Register = () => {
               onChange={(e) => setConfirmPassword(e.target.value)}
               disabled={loading}
             />
+            <TextField
+              margin="normal"
+              fullWidth
+              name="inviteCode"
+              label="邀请码"
+              id="inviteCode"
+              helperText="未开放注册时需要填写管理员提供的邀请码"
+              value={inviteCode}
+              onChange={(e) => setInviteCode(e.target.value)}
+              disabled={loading}
+            />
             <Button
               type="submit"
               fullWidth
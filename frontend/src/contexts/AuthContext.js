@@ -3,6 +3,63 @@ import axios from 'axios';
 
 const AuthContext = createContext();
 
+// 保存令牌并设置axios默认头部
+const saveTokens = (token, refreshToken) => {
+  localStorage.setItem('token', token);
+  if (refreshToken) {
+    localStorage.setItem('refresh_token', refreshToken);
+  }
+  axios.defaults.headers.common['Authorization'] = `Bearer ${token}`;
+};
+
+// 清除本地保存的令牌
+const clearTokens = () => {
+  localStorage.removeItem('token');
+  localStorage.removeItem('refresh_token');
+  delete axios.defaults.headers.common['Authorization'];
+};
+
+// 并发请求同时过期时只刷新一次
+let refreshPromise = null;
+
+const refreshAccessToken = async () => {
+  const refreshToken = localStorage.getItem('refresh_token');
+  if (!refreshToken) {
+    throw new Error('no refresh token');
+  }
+  if (!refreshPromise) {
+    refreshPromise = axios
+      .post('/api/auth/refresh', { refresh_token: refreshToken }, { skipAuthRefresh: true })
+      .then((response) => {
+        const { token, refresh_token } = response.data;
+        saveTokens(token, refresh_token);
+        return token;
+      })
+      .finally(() => {
+        refreshPromise = null;
+      });
+  }
+  return refreshPromise;
+};
+
+// WebAuthn的二进制字段与base64url互相转换
+const base64urlToBuffer = (value) => {
+  const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+  const binary = atob(base64 + '='.repeat((4 - (base64.length % 4)) % 4));
+  return Uint8Array.from(binary, (c) => c.charCodeAt(0)).buffer;
+};
+
+const bufferToBase64url = (buffer) => {
+  if (!buffer) {
+    return '';
+  }
+  const binary = String.fromCharCode(...new Uint8Array(buffer));
+  return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+};
+
+// 浏览器是否支持通行密钥
+export const isPasskeySupported = () => typeof window !== 'undefined' && !!window.PublicKeyCredential;
+
 export const useAuth = () => useContext(AuthContext);
 
 export const AuthProvider = ({ children }) => {
@@ -11,8 +68,48 @@ export const AuthProvider = ({ children }) => {
   const [isAuthenticated, setIsAuthenticated] = useState(false);
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState('');
+  // 密码验证通过后等待提交两步验证码的挑战令牌
+  const [twoFactorChallenge, setTwoFactorChallenge] = useState(null);
 
   useEffect(() => {
+    // 访问令牌过期时使用刷新令牌自动续期并重试原请求
+    const interceptor = axios.interceptors.response.use(
+      (response) => response,
+      async (err) => {
+        const request = err.config;
+        if (err.response?.status !== 401 || !request || request.skipAuthRefresh || request._retried) {
+          return Promise.reject(err);
+        }
+        try {
+          const token = await refreshAccessToken();
+          request._retried = true;
+          request.headers['Authorization'] = `Bearer ${token}`;
+          return axios(request);
+        } catch (refreshErr) {
+          clearTokens();
+          setCurrentUser(null);
+          setIsAuthenticated(false);
+          return Promise.reject(err);
+        }
+      }
+    );
+    return () => axios.interceptors.response.eject(interceptor);
+  }, []);
+
+  useEffect(() => {
+    // 单点登录回调通过URL片段传回令牌或错误
+    const params = new URLSearchParams(window.location.hash.slice(1));
+    if (params.has('token') || params.has('challenge_token') || params.has('error')) {
+      window.history.replaceState(null, '', window.location.pathname + window.location.search);
+      if (params.has('token')) {
+        saveTokens(params.get('token'), params.get('refresh_token'));
+      } else if (params.has('challenge_token')) {
+        setTwoFactorChallenge(params.get('challenge_token'));
+      } else {
+        setError(`单点登录失败：${params.get('error')}`);
+      }
+    }
+
     // 检查本地存储中是否有令牌
     const token = localStorage.getItem('token');
     if (token) {
@@ -33,8 +130,7 @@ export const AuthProvider = ({ children }) => {
       setIsAuthenticated(true);
     } catch (err) {
       // 如果令牌无效，清除本地存储
-      localStorage.removeItem('token');
-      delete axios.defaults.headers.common['Authorization'];
+      clearTokens();
     } finally {
       setLoading(false);
     }
@@ -44,17 +140,15 @@ export const AuthProvider = ({ children }) => {
   const login = async (username, password) => {
     try {
       setError('');
-      const response = await axios.post('/api/auth/login', { username, password });
-      const { token, user } = response.data;
-      
-      // 保存令牌到本地存储
-      localStorage.setItem('token', token);
-      
-      // 设置axios默认头部
-      axios.defaults.headers.common['Authorization'] = `Bearer ${token}`;
-      
-      setCurrentUser(user);
-      setIsAuthenticated(true);
+      const response = await axios.post('/api/auth/login', { username, password }, { skipAuthRefresh: true });
+
+      // 启用了两步验证时需要继续提交验证码
+      if (response.data.two_factor_required) {
+        setTwoFactorChallenge(response.data.challenge_token);
+        return false;
+      }
+
+      completeLogin(response.data);
       return true;
     } catch (err) {
       setError(err.response?.data?.message || '登录失败');
@@ -62,11 +156,106 @@ export const AuthProvider = ({ children }) => {
     }
   };
 
+  // 两步验证函数，code可以是验证器应用生成的验证码或恢复码
+  const verifyTwoFactor = async (code) => {
+    try {
+      setError('');
+      const payload = { challenge_token: twoFactorChallenge };
+      if (/^\d{6}$/.test(code.trim())) {
+        payload.code = code.trim();
+      } else {
+        payload.recovery_code = code;
+      }
+      const response = await axios.post('/api/auth/login/2fa', payload, { skipAuthRefresh: true });
+      setTwoFactorChallenge(null);
+      completeLogin(response.data);
+      return true;
+    } catch (err) {
+      if (err.response?.data?.error === 'invalid_challenge') {
+        // 挑战令牌已过期，需要重新输入密码
+        setTwoFactorChallenge(null);
+      }
+      setError(err.response?.data?.message || '验证失败');
+      return false;
+    }
+  };
+
+  // 通行密钥登录函数，username可为空，由认证器列出可用的通行密钥
+  const loginWithPasskey = async (username) => {
+    try {
+      setError('');
+      const { data } = await axios.post('/api/auth/webauthn/login/options', { username }, { skipAuthRefresh: true });
+      const options = data.publicKey;
+      const credential = await navigator.credentials.get({
+        publicKey: {
+          ...options,
+          challenge: base64urlToBuffer(options.challenge),
+          allowCredentials: options.allowCredentials.map((c) => ({ ...c, id: base64urlToBuffer(c.id) })),
+        },
+      });
+      const response = await axios.post('/api/auth/webauthn/login', {
+        credential: {
+          id: bufferToBase64url(credential.rawId),
+          response: {
+            clientDataJSON: bufferToBase64url(credential.response.clientDataJSON),
+            authenticatorData: bufferToBase64url(credential.response.authenticatorData),
+            signature: bufferToBase64url(credential.response.signature),
+            userHandle: bufferToBase64url(credential.response.userHandle),
+          },
+        },
+      }, { skipAuthRefresh: true });
+
+      // 通行密钥未经用户验证且启用了两步验证时需要继续提交验证码
+      if (response.data.two_factor_required) {
+        setTwoFactorChallenge(response.data.challenge_token);
+        return false;
+      }
+
+      completeLogin(response.data);
+      return true;
+    } catch (err) {
+      setError(err.response?.data?.message || '通行密钥登录失败');
+      return false;
+    }
+  };
+
+  // 为当前账户注册通行密钥
+  const registerPasskey = async (name) => {
+    const { data } = await axios.post('/api/auth/webauthn/register/options');
+    const options = data.publicKey;
+    const credential = await navigator.credentials.create({
+      publicKey: {
+        ...options,
+        challenge: base64urlToBuffer(options.challenge),
+        user: { ...options.user, id: base64urlToBuffer(options.user.id) },
+        excludeCredentials: options.excludeCredentials.map((c) => ({ ...c, id: base64urlToBuffer(c.id) })),
+      },
+    });
+    await axios.post('/api/auth/webauthn/register', {
+      name,
+      credential: {
+        id: bufferToBase64url(credential.rawId),
+        response: {
+          clientDataJSON: bufferToBase64url(credential.response.clientDataJSON),
+          attestationObject: bufferToBase64url(credential.response.attestationObject),
+        },
+      },
+    });
+  };
+
+  const completeLogin = ({ token, refresh_token, user }) => {
+    // 保存令牌到本地存储并设置axios默认头部
+    saveTokens(token, refresh_token);
+
+    setCurrentUser(user);
+    setIsAuthenticated(true);
+  };
+
   // 注册函数
-  const register = async (username, password) => {
+  const register = async (username, password, inviteCode) => {
     try {
       setError('');
-      await axios.post('/api/auth/register', { username, password });
+      await axios.post('/api/auth/register', { username, password, invite_code: inviteCode || undefined });
       return true;
     } catch (err) {
       setError(err.response?.data?.message || '注册失败');
@@ -75,9 +264,14 @@ export const AuthProvider = ({ children }) => {
   };
 
   // 登出函数
-  const logout = () => {
-    localStorage.removeItem('token');
-    delete axios.defaults.headers.common['Authorization'];
+  const logout = async () => {
+    try {
+      // 通知服务端撤销当前会话
+      await axios.post('/api/auth/logout', null, { skipAuthRefresh: true });
+    } catch (err) {
+      // 会话可能已失效，忽略错误
+    }
+    clearTokens();
     setCurrentUser(null);
     setIsAuthenticated(false);
   };
@@ -87,7 +281,11 @@ export const AuthProvider = ({ children }) => {
     isAuthenticated,
     loading,
     error,
+    twoFactorChallenge,
     login,
+    verifyTwoFactor,
+    loginWithPasskey,
+    registerPasskey,
     register,
     logout,
   };